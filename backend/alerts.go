@@ -0,0 +1,182 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+)
+
+// Alert is a notification about tomorrow's prices. Key is the same every
+// time the same alert comes up, so it is only sent once
+type Alert struct {
+	Key     string
+	Title   string
+	Message string
+}
+
+// AlertRules are what is worth a notification once tomorrow's prices are
+// known. Each rule is off when left at zero
+type AlertRules struct {
+	// Above is the price in øre/kWh, as paid, that hours above are
+	// notified of
+	Above float64
+	// Negative notifies of hours with a negative spot price
+	Negative bool
+	// Window is the length of the cheapest run of hours to notify of
+	Window time.Duration
+}
+
+// TomorrowAlerts checks tomorrow's prices against the rules, there are no
+// alerts until they are published
+func (power *Power) TomorrowAlerts(now time.Time, rules AlertRules) ([]Alert, error) {
+	now = now.In(power.Location)
+	tomorrow := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, power.Location)
+	end := tomorrow.AddDate(0, 0, 1)
+	spot, err := power.PricesBetween(tomorrow, end)
+	if err != nil {
+		return nil, err
+	}
+	if len(spot) == 0 || spot[len(spot)-1].End.Before(end) {
+		return nil, nil
+	}
+	prices := power.consumerPrices(append([]PriceInterval(nil), spot...))
+	date := tomorrow.Format("2006-01-02")
+	span := func(p PriceInterval) string {
+		return p.Start.In(power.Location).Format("15:04") + "–" + p.End.In(power.Location).Format("15:04")
+	}
+
+	var alerts []Alert
+	if rules.Above > 0 {
+		runs := priceRuns(prices, func(p PriceInterval) bool { return p.Price*100 > rules.Above }, math.Max)
+		if len(runs) > 0 {
+			var lines []string
+			for _, run := range runs {
+				lines = append(lines, fmt.Sprintf("%s up to %.0f øre/kWh", span(run), run.Price*100))
+			}
+			alerts = append(alerts, Alert{
+				Key:     "above-" + date,
+				Title:   fmt.Sprintf("Prices over %.0f øre tomorrow", rules.Above),
+				Message: strings.Join(lines, "\n"),
+			})
+		}
+	}
+	if rules.Negative {
+		runs := priceRuns(spot, func(p PriceInterval) bool { return p.Price < 0 }, math.Min)
+		if len(runs) > 0 {
+			var lines []string
+			for _, run := range runs {
+				lines = append(lines, fmt.Sprintf("%s down to %.0f øre/kWh spot", span(run), run.Price*100))
+			}
+			alerts = append(alerts, Alert{
+				Key:     "negative-" + date,
+				Title:   "Negative prices tomorrow",
+				Message: strings.Join(lines, "\n"),
+			})
+		}
+	}
+	if rules.Window > 0 {
+		best, err := cheapestWindow(prices, tomorrow, rules.Window, end)
+		if err == nil {
+			alerts = append(alerts, Alert{
+				Key:     "window-" + date,
+				Title:   fmt.Sprintf("Cheapest %s tomorrow", shortDuration(rules.Window)),
+				Message: fmt.Sprintf("%s, avg %.0f øre/kWh", span(best), best.Price*100),
+			})
+		} else if !errors.Is(err, ErrNoWindow) {
+			return alerts, err
+		}
+	}
+	return alerts, nil
+}
+
+// shortDuration formats whole hours and minutes without the zeros, 3h
+// rather than 3h0m0s
+func shortDuration(d time.Duration) string {
+	s := d.String()
+	s = strings.TrimSuffix(s, "0s")
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
+
+// priceRuns joins the back to back prices that match into runs, each with
+// the price pick chooses out of it
+func priceRuns(prices []PriceInterval, match func(PriceInterval) bool, pick func(a, b float64) float64) []PriceInterval {
+	var runs []PriceInterval
+	for _, p := range prices {
+		if !match(p) {
+			continue
+		}
+		if n := len(runs); n > 0 && runs[n-1].End.Equal(p.Start) {
+			runs[n-1].End = p.End
+			runs[n-1].Price = pick(runs[n-1].Price, p.Price)
+			continue
+		}
+		runs = append(runs, p)
+	}
+	return runs
+}
+
+// SendAlerts notifies of tomorrow's prices, each alert only the first time
+// it comes up
+func SendAlerts(config *Config, power *Power) error {
+	notifiers, err := NewNotifiers(config)
+	if err != nil {
+		return err
+	}
+	if len(notifiers) == 0 {
+		return errors.New("no notifications configured")
+	}
+	alerts, err := power.TomorrowAlerts(time.Now(), config.AlertRules())
+	if err != nil {
+		return err
+	}
+	var failed error
+	for _, alert := range alerts {
+		sent, err := power.notified(alert.Key)
+		if err != nil {
+			return err
+		}
+		if sent {
+			continue
+		}
+		// an alert counts as sent once any notifier has it, so one that is
+		// down does not cause repeats on the others
+		delivered := false
+		for _, n := range notifiers {
+			if err := n.Notify(alert.Title, alert.Message); err != nil {
+				log.Println("sending alert:", err)
+				failed = err
+				continue
+			}
+			delivered = true
+		}
+		if delivered {
+			if err := power.markNotified(alert.Key); err != nil {
+				return err
+			}
+		}
+	}
+	return failed
+}
+
+// notified is whether an alert has been sent
+func (power *Power) notified(key string) (bool, error) {
+	var sent string
+	err := power.Db.QueryRow("select sent from notifications where key = $1", key).Scan(&sent)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (power *Power) markNotified(key string) error {
+	_, err := power.Db.Exec("insert or replace into notifications (key, sent) values ($1, $2)",
+		key, time.Now().UTC().Format(usageFormat))
+	return err
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// alertPower has tomorrow's hourly spot prices stored, 0.5 DKK/kWh apart
+// from 2 from 17 to 19 and -0.1 from 13 to 14
+func alertPower(t *testing.T, loc *time.Location) *Power {
+	t.Helper()
+	power := testPower(t, loc)
+	now := time.Now().In(loc)
+	tomorrow := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, loc)
+	var prices []PriceInterval
+	for s := tomorrow; s.Before(tomorrow.AddDate(0, 0, 1)); s = s.Add(time.Hour) {
+		p := PriceInterval{Start: s, End: s.Add(time.Hour), Price: 0.5}
+		switch hour := s.In(loc).Hour(); {
+		case hour == 17 || hour == 18:
+			p.Price = 2
+		case hour == 13:
+			p.Price = -0.1
+		}
+		prices = append(prices, p)
+	}
+	if err := power.StorePrices(prices); err != nil {
+		t.Fatal(err)
+	}
+	return power
+}
+
+func TestSendAlertsOnce(t *testing.T) {
+	loc := copenhagen(t)
+	power := alertPower(t, loc)
+	server, notifications := notifyServer(t, http.StatusOK)
+	addr, mails := smtpServer(t)
+	config := &Config{
+		Location:      loc,
+		NotifyService: "ntfy",
+		NotifyURL:     server.URL + "/prices",
+		SMTPServer:    addr,
+		MailFrom:      "display@example.com",
+		MailTo:        "a@example.com",
+		AlertAbove:    100,
+		AlertNegative: true,
+	}
+	if err := SendAlerts(config, power); err != nil {
+		t.Fatal(err)
+	}
+	n := notifications()
+	if len(n) != 2 || len(mails()) != 2 {
+		t.Fatalf("got %d notifications and %d mails, want 2 of each", len(n), len(mails()))
+	}
+	if n[0].title != "Prices over 100 øre tomorrow" || n[0].message != "17:00–19:00 up to 200 øre/kWh" {
+		t.Errorf("got %q: %q", n[0].title, n[0].message)
+	}
+	if n[1].title != "Negative prices tomorrow" || n[1].message != "13:00–14:00 down to -10 øre/kWh spot" {
+		t.Errorf("got %q: %q", n[1].title, n[1].message)
+	}
+
+	date := time.Now().In(loc).AddDate(0, 0, 1).Format("2006-01-02")
+	for _, key := range []string{"above-" + date, "negative-" + date} {
+		if sent, err := power.notified(key); err != nil || !sent {
+			t.Errorf("%s is not in notifications: %v", key, err)
+		}
+	}
+
+	// the next run finds them in the notifications table
+	if err := SendAlerts(config, power); err != nil {
+		t.Fatal(err)
+	}
+	if len(notifications()) != 2 || len(mails()) != 2 {
+		t.Errorf("got %d notifications and %d mails after sending again", len(notifications()), len(mails()))
+	}
+}
+
+func TestSendAlertsFailing(t *testing.T) {
+	loc := copenhagen(t)
+	failing, _ := notifyServer(t, http.StatusInternalServerError)
+	addr, mails := smtpServer(t)
+	config := &Config{
+		Location:      loc,
+		NotifyService: "gotify",
+		NotifyURL:     failing.URL,
+		SMTPServer:    addr,
+		MailFrom:      "display@example.com",
+		MailTo:        "a@example.com",
+		AlertNegative: true,
+	}
+	date := time.Now().In(loc).AddDate(0, 0, 1).Format("2006-01-02")
+
+	// the mail gets through, so the alert is not sent again
+	power := alertPower(t, loc)
+	if err := SendAlerts(config, power); err == nil || !strings.Contains(err.Error(), "500") {
+		t.Errorf("got %v, want the Gotify error", err)
+	}
+	if sent, _ := power.notified("negative-" + date); !sent {
+		t.Error("the mailed alert is not marked as sent")
+	}
+	SendAlerts(config, power)
+	if len(mails()) != 1 {
+		t.Errorf("got %d mails, want 1", len(mails()))
+	}
+
+	// with nothing getting through it is tried again next time
+	config.SMTPServer = ""
+	power = alertPower(t, loc)
+	if err := SendAlerts(config, power); err == nil {
+		t.Error("no error when no notifier works")
+	}
+	if sent, _ := power.notified("negative-" + date); sent {
+		t.Error("an alert that was not delivered is marked as sent")
+	}
+}
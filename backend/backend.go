@@ -1,138 +1,719 @@
 package main
 
 import (
+	"fmt"
 	"image"
 	"log"
 	"math"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
-	"golang.org/x/image/bmp"
 )
 
 func main() {
-	width, height := 800, 480
-	screen := NewScreen(width, height)
-	screen.LoadFont("fonts/FontsFree-Net-HelveticaNeueMedium.ttf")
-
-	// Title Box
-	screen.DrawRect(0, 0, width, 50, image.Black)
-	screen.DrawHorizontalLine(height-20, 0, width)
-
-	// Title text
-	screen.Write(dateNow(), width/2, 25, false, true)
-
-	/********* Electricity section ***********/
-	power := NewPower("/home/timothy/src/display/electricity.db")
-	screen.DrawRect(404, 55, 692, 85, image.Black)
-	screen.Write("Current KWh Cost", 548, 70, false, false)
-	screen.Write(strconv.Itoa(power.CurrentCost()), 750, 70, true, true)
-
-	costGraph(screen, power)
-
-	screen.DrawRect(420, 345, 780, 450, image.White)
-	screen.DrawRect(430, 350, 535, 370, image.Black) // 482
-	screen.DrawRect(545, 350, 655, 370, image.Black) // 600
-	screen.DrawRect(665, 350, 770, 370, image.Black) // 718
-	usage := power.WeekUseage()
-	screen.Write("Last Week", 482, 360, false, false)
-	screen.Write(usage.Amount+"KWh", 482, 385, true, false)
-	screen.Write(usage.Cost, 482, 410, true, false)
-	screen.Write(usage.Efficiency+"%", 482, 435, true, false)
-	usage = power.PrevDayUseage()
-	screen.Write(usage.Date, 600, 360, false, false)
-	screen.Write(usage.Amount+"KWh", 600, 385, true, false)
-	screen.Write(usage.Cost, 600, 410, true, false)
-	screen.Write(usage.Efficiency+"%", 600, 435, true, false)
-	usage = power.DayUseage()
-	screen.Write(usage.Date, 718, 360, false, false)
-	screen.Write(usage.Amount+"KWh", 718, 385, true, false)
-	screen.Write(usage.Cost, 718, 410, true, false)
-	screen.Write(usage.Efficiency+"%", 718, 435, true, false)
-
-	/********* Weather Section ************/
-	weather := NewWeather("55.7034", "12.5823")
-    if weather != nil {
-
-        screen.Write(weather.Sunrise(), width/8, 25, false, false)
-        screen.Write(weather.Sunset(), 7*width/8, 25, false, false)
-
-        screen.Write(weather.Conditions(), 100, 80, true, true)
-        screen.DrawHorizontalLine(110, 4, 192)
-        screen.Write(weather.WindSpeed()+"m/s ("+weather.WindDirection()+")", 100, 150, true, true)
-        screen.DrawRect(4, 168, 196, 188, image.Black)
-        screen.Write(weather.WindGust()+"m/s gusts", 100, 178, false, false)
-
-        screen.Write(weather.Temp()+"°C", 250, 75, true, true)
-        screen.DrawRect(202, 90, 298, 110, image.Black)
-        screen.Write(weather.MaxTemp()+" / "+weather.MinTemp()+"°C", 250, 100, false, false)
-
-        screen.Write(weather.PrecipitationAmount()+"mm", 350, 75, true, true)
-        screen.DrawRect(302, 90, 398, 110, image.Black)
-        screen.Write(weather.DayPrecipitationAmount()+"mm", 350, 100, false, false)
-
-        screen.Write(weather.Humidity()+"%", 250, 135, true, true)
-        screen.DrawHorizontalLine(152, 202, 96)
-        screen.Write("UV "+weather.UV(), 350, 135, true, true)
-        screen.DrawHorizontalLine(152, 302, 96)
-
-        screen.Write(weather.Visibility()+weather.VisibiltyDistance(), 250, 170, true, true)
-        screen.DrawHorizontalLine(187, 202, 96)
-        screen.Write(weather.Pressure(), 350, 170, true, true)
-        screen.DrawHorizontalLine(187, 302, 96)
-        //screen.Write("hPa", 400, 173, true, false)
-
-        // next five days
-        x := 40
-        y := 390
-        for _, f := range weather.Forecast() {
-            weekcol := true
-            if f.Weekend {
-                screen.DrawRect(x-39, y+20, x+39, y+60, image.Black)
-                weekcol = false
-            } else {
-                screen.DrawRect(x-39, y, x+39, y+20, image.Black)
-            }
-            screen.Write(f.Date, x, y+10, !weekcol, false)
-            screen.Write(f.TempMax+" / "+f.TempMin+"°C", x, y+30, weekcol, false)
-            screen.Write(f.PrecipitationAmount+" mm", x, y+50, weekcol, false)
-            x += 80
-        }
-
-	    weatherGraph(screen, weather)
-    } else {
-        screen.Write("Cannot Contact Weather Service", width/4, height/2, true, false)
-    }
-
-	// when this was created
-	screen.Write(time.Now().Format("2006-01-02 15:04:05"), width/2, height-10, true, false)
-
-	bmp8, err := os.Create("full.bmp")
+	args := os.Args[1:]
+	command := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+	config, err := LoadConfig(args)
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer bmp8.Close()
-	err = bmp.Encode(bmp8, screen.Image)
+
+	switch command {
+	case "":
+	case "fetch-prices":
+		err = runCommand(config, FetchPrices)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	case "fetch-co2":
+		err = runCommand(config, FetchEmissions)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	case "notify":
+		err = runCommand(config, SendAlerts)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	case "import-usage":
+		err = runCommand(config, ImportUsage)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	case "import-submeter":
+		err = runCommand(config, ImportSubMeter)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	case "import-production":
+		err = runCommand(config, ImportProduction)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	case "read-han":
+		err = runCommand(config, ReadMeter)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	default:
+		log.Fatalf("unknown command %q", command)
+	}
+
+	dashboard, err := NewDashboard(config)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	oneBmp, err := os.Create("out.bmp")
+	if config.Daemon {
+		err = RunDaemon(dashboard, func() (*Config, error) {
+			return LoadConfig(args)
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	err = dashboard.Update(Sources...)
+	dashboard.Close()
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer oneBmp.Close()
-	bits := screen.OneBitImage()
-	_, err = oneBmp.Write(bits)
+}
+
+// runCommand runs a command that only needs the database
+func runCommand(config *Config, command func(*Config, *Power) error) error {
+	power, err := NewPower(config.Database, config.Location)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-	oneBmp.Sync()
+	defer power.Db.Close()
+	return command(config, power)
+}
+
+func datePanel(r *Renderer, p *Panel) {
+	r.Screen.Write(dateNow(), p.X, p.Y, p.Style != "white", p.Large)
+}
+
+// timestampPanel shows when the image was created
+func timestampPanel(r *Renderer, p *Panel) {
+	r.Screen.Write(time.Now().Format("2006-01-02 15:04:05"), p.X, p.Y, p.Style != "white", p.Large)
 }
 
-func weatherGraph(screen *Screen, weather *Weather) {
+// sunPanel shows sunrise and sunset at either end of the panel
+func sunPanel(r *Renderer, p *Panel) {
+	if r.Weather == nil {
+		return
+	}
+	black := p.Style != "white"
+	r.write(p, r.Weather.Sunrise(), p.Width/8, p.Height/2, black, false)
+	r.write(p, r.Weather.Sunset(), 7*p.Width/8, p.Height/2, black, false)
+}
+
+func currentCostPanel(r *Renderer, p *Panel) {
+	if r.errs["current-cost"] != nil {
+		r.panelError(p, "No Current Price")
+		return
+	}
+	labelWidth := p.Width * 3 / 4
+	if r.levels == nil {
+		r.rect(p, 0, 0, labelWidth, p.Height, image.Black)
+		r.write(p, "Current KWh Cost", labelWidth/2, p.Height/2, false, false)
+	} else {
+		// the label box shrinks to make room for the price level
+		boxWidth := r.Screen.TextWidth("Current KWh Cost", false) + 10
+		r.rect(p, 0, 0, boxWidth, p.Height, image.Black)
+		r.write(p, "Current KWh Cost", boxWidth/2, p.Height/2, false, false)
+		level := r.levels.Level(float64(r.currentCost)).String()
+		r.write(p, level, (boxWidth+labelWidth)/2, p.Height/2, true, false)
+	}
+	r.write(p, strconv.Itoa(r.currentCost), (p.Width+labelWidth)/2, p.Height/2, true, true)
+}
+
+// livePanel shows the power being drawn from the grid right now, as read
+// from the meter's HAN port, and what is fed into it when there is any
+func livePanel(r *Renderer, p *Panel) {
+	if r.Meter == nil {
+		r.panelError(p, "No Meter")
+		return
+	}
+	m := r.Meter.Latest()
+	if m == nil {
+		r.panelError(p, "No Meter Reading")
+		return
+	}
+	labelWidth := p.Width / 2
+	r.rect(p, 0, 0, labelWidth, p.Height, image.Black)
+	r.write(p, "Using Now", labelWidth/2, p.Height/2, false, false)
+	text := fmt.Sprintf("%.0f W", m.Import)
+	if m.Export > 0 {
+		text += fmt.Sprintf(" / -%.0f W", m.Export)
+	}
+	r.write(p, text, (p.Width+labelWidth)/2, p.Height/2, true, false)
+}
+
+// usagePanel is one column of the usage table, Source is one of
+// week, prevday or day. With export the cost is net of what it earned, and
+// panels tall enough for it get a row with the export. With Meter set it
+// shows that meter, headed by its name
+func usagePanel(r *Renderer, p *Panel) {
+	source := p.Source
+	if source != "week" && source != "prevday" {
+		source = "day"
+	}
+	key := usageKey(p.Meter, source)
+	if r.errs[key] != nil {
+		r.panelError(p, "No Data")
+		return
+	}
+	usage := r.usage[key]
+	label := usage.Date
+	if source == "week" {
+		label = "Last Week"
+	} else if len(label) == 10 && r.Screen.TextWidth(label, false) >= p.Width {
+		// the year is left out when the panel is narrow
+		label = label[5:]
+	}
+	if key != source {
+		// the month and day follow the meter when there is room
+		label = p.Meter
+		if source != "week" && len(usage.Date) == 10 {
+			if dated := label + " " + usage.Date[5:]; r.Screen.TextWidth(dated, false) < p.Width {
+				label = dated
+			}
+		}
+	}
+	x := p.Width / 2
+	r.rect(p, 0, 0, p.Width, 20, image.Black)
+	r.write(p, label, x, 10, false, false)
+	r.write(p, usage.Amount+"KWh", x, 35, true, false)
+	if usage.NetCost != "" {
+		r.write(p, usage.NetCost+" net", x, 60, true, false)
+	} else {
+		r.write(p, usage.Cost, x, 60, true, false)
+	}
+	if usage.Score != "" {
+		r.write(p, "Score "+usage.Score, x, 85, true, false)
+	} else {
+		r.write(p, usage.CheapShare+"% cheap", x, 85, true, false)
+	}
+	if usage.Exported != "" && p.Height >= 120 {
+		export := usage.Exported + "KWh out"
+		if usage.SelfConsumption != "" {
+			export += ", " + usage.SelfConsumption + "% own"
+		}
+		r.write(p, export, x, 110, true, false)
+	}
+}
+
+// co2Panel shows the CO2 emitted producing the electricity used, Source is
+// week, prevday or day like the usage panels and defaults to week
+func co2Panel(r *Renderer, p *Panel) {
+	source := p.Source
+	if source != "prevday" && source != "day" {
+		source = "week"
+	}
+	key := usageKey(p.Meter, source)
+	usage := r.usage[key]
+	if r.errs[key] != nil || usage.CO2 == "" {
+		r.panelError(p, "No CO2 Data")
+		return
+	}
+	x := p.Width / 2
+	r.rect(p, 0, 0, p.Width, 20, image.Black)
+	r.write(p, "CO2", x, 10, false, false)
+	r.write(p, usage.CO2+" kg", x, 35, true, false)
+	r.write(p, usage.Intensity+" g/KWh", x, 60, true, false)
+}
+
+// summaryPanel compares a calendar period, Source is one of month,
+// last-month, year or day, with the one before. Each figure has an arrow
+// showing if it went up or down and by how much
+func summaryPanel(r *Renderer, p *Panel) {
+	period := p.Source
+	if period != LastMonthPeriod && period != YearPeriod && period != DayPeriod {
+		period = MonthPeriod
+	}
+	if r.errs["summary-"+period] != nil {
+		r.panelError(p, "No Data")
+		return
+	}
+	c := r.summaries[period]
+	labels := map[string]string{
+		MonthPeriod:     "This Month",
+		LastMonthPeriod: c.Current.From.Format("January"),
+		YearPeriod:      "This Year",
+		DayPeriod:       c.Current.From.Format("2 Jan"),
+	}
+	x := p.Width / 2
+	r.rect(p, 0, 0, p.Width, 20, image.Black)
+	r.write(p, labels[period], x, 10, false, false)
+
+	rows := []struct {
+		value             string
+		current, previous float64
+	}{
+		{fmt.Sprintf("%0.1fKWh", c.Current.Amount), c.Current.Amount, c.Previous.Amount},
+		{fmt.Sprintf("%0.2f kr", c.Current.Cost), c.Current.Cost, c.Previous.Cost},
+		{fmt.Sprintf("%0.0f øre", c.Current.Price), c.Current.Price, c.Previous.Price},
+	}
+	for i, row := range rows {
+		y := 35 + 22*i
+		r.write(p, row.value, p.Width*3/8, y, true, false)
+		change, err := Change(row.current, row.previous)
+		if err != nil {
+			r.write(p, "-", p.Width*7/8, y, true, false)
+			continue
+		}
+		r.arrow(p, p.Width*3/4-6, y, change >= 0)
+		r.write(p, fmt.Sprintf("%0.0f%%", math.Abs(change)), p.Width*7/8, y, true, false)
+	}
+
+	// the score is already a percentage, so it changes by points
+	y := 35 + 22*len(rows)
+	score, ok := c.Current.Shifting.Score()
+	if !ok {
+		r.write(p, fmt.Sprintf("%0.0f%% cheap", c.Current.Shifting.CheapShare()), p.Width*3/8, y, true, false)
+		return
+	}
+	r.write(p, fmt.Sprintf("Score %0.0f", score), p.Width*3/8, y, true, false)
+	previous, ok := c.Previous.Shifting.Score()
+	if !ok {
+		r.write(p, "-", p.Width*7/8, y, true, false)
+		return
+	}
+	r.arrow(p, p.Width*3/4-6, y, score >= previous)
+	r.write(p, fmt.Sprintf("%0.0f", math.Abs(score-previous)), p.Width*7/8, y, true, false)
+}
+
+// budgetPanel shows the month's spending as a bar filling up towards the
+// budget, with a mark where it is projected to end up. The bar is shaded if
+// it is projected over the budget, and the whole panel turns black once the
+// spending has gone over
+func budgetPanel(r *Renderer, p *Panel) {
+	if r.Budget <= 0 {
+		r.panelError(p, "No Budget Set")
+		return
+	}
+	if r.errs["budget"] != nil {
+		r.panelError(p, "No Data")
+		return
+	}
+	b := r.budget
+	black, colour := true, image.White
+	if b.Over() {
+		black, colour = false, image.Black
+	}
+	r.rect(p, 0, 0, p.Width, p.Height, colour)
+	text := fmt.Sprintf("%.0f / %.0f kr, projected %.0f", b.Spent, b.Limit, b.Projected)
+	r.write(p, text, p.Width/2, 10, black, false)
+
+	// the bar runs to a bit past the budget so overshooting shows
+	top, bottom := 22, p.Height-2
+	left, right := 2, p.Width-2
+	scale := math.Max(b.Limit, math.Max(b.Spent, b.Projected)) * 1.05
+	xPos := func(amount float64) int {
+		return left + int(amount/scale*float64(right-left))
+	}
+	ink := image.Black
+	if b.Over() {
+		ink = image.White
+	}
+	r.rect(p, left, top, right, top+1, ink)
+	r.rect(p, left, bottom-1, right, bottom, ink)
+	r.rect(p, left, top, left+1, bottom, ink)
+	r.rect(p, right-1, top, right, bottom, ink)
+	spent := xPos(b.Spent)
+	if b.Projected > b.Limit && !b.Over() {
+		r.Screen.DrawPattern(p.X+left, p.Y+top, p.X+spent, p.Y+bottom, func(x, y int) bool {
+			return (x+y)%3 != 0
+		})
+	} else {
+		r.rect(p, left, top, spent, bottom, ink)
+	}
+	// the budget is a tall line and the projection a short one
+	limit := xPos(b.Limit)
+	r.rect(p, limit-1, top-4, limit+1, bottom+2, ink)
+	projected := xPos(b.Projected)
+	r.rect(p, projected, top+2, projected+1, bottom-2, ink)
+}
+
+// heatmapPanel shows when electricity is used through the week, averaged
+// over the last Weeks weeks
+func heatmapPanel(r *Renderer, p *Panel) {
+	weeks := p.Weeks
+	if weeks <= 0 {
+		weeks = 4
+	}
+	heatmap, ok := r.heatmaps[weeks]
+	if !ok {
+		var err error
+		heatmap, err = r.Power.HourOfWeek(weeks, time.Now())
+		if err != nil {
+			log.Println("heatmap:", err)
+		}
+		if r.heatmaps == nil {
+			r.heatmaps = make(map[int]*Heatmap)
+		}
+		r.heatmaps[weeks] = heatmap
+	}
+	if heatmap == nil {
+		r.panelError(p, "No Data")
+		return
+	}
+	heatmapGraph(r.Screen, heatmap, p.X, p.Y, p.Width, p.Height)
+}
+
+// shiftingPanel is the trend in load shifting over the last Weeks weeks, 4
+// by default, with a bar for each day's score and each week's score
+// underneath
+func shiftingPanel(r *Renderer, p *Panel) {
+	weeks := p.Weeks
+	if weeks <= 0 {
+		weeks = 4
+	}
+	now := time.Now().In(r.Power.Location)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, r.Power.Location)
+	start := today.AddDate(0, 0, -7*weeks)
+	history, ok := r.shifting[weeks]
+	if !ok {
+		var err error
+		history, err = r.Power.ShiftingHistory(start, today)
+		if err != nil {
+			log.Println("shifting history:", err)
+		}
+		if r.shifting == nil {
+			r.shifting = make(map[int][]Shifting)
+		}
+		r.shifting[weeks] = history
+	}
+	if len(history) == 0 {
+		r.panelError(p, "No Data")
+		return
+	}
+
+	r.rect(p, 0, 0, p.Width, 20, image.Black)
+	r.write(p, "Load Shifting Score", p.Width/2, 10, false, false)
+	top, bottom := 26, p.Height-22
+	// weeks are kept apart by a 2 px gap
+	dayWidth := (p.Width - 2*(weeks-1)) / (7 * weeks)
+	week := make([]Shifting, weeks)
+	for _, d := range history {
+		// days are counted by date so the clocks changing does not matter
+		index := int(math.Round(d.Day.Sub(start).Hours() / 24))
+		if index < 0 || index >= 7*weeks {
+			continue
+		}
+		week[index/7].add(d)
+		score, ok := d.Score()
+		if !ok || score <= 0 {
+			continue
+		}
+		height := int(math.Min(score, 100) / 100 * float64(bottom-top))
+		x := index*dayWidth + index/7*2
+		r.rect(p, x, bottom-height, x+dayWidth-1, bottom, image.Black)
+	}
+	r.rect(p, 0, bottom, p.Width, bottom+1, image.Black)
+	for i, w := range week {
+		label := "-"
+		if score, ok := w.Score(); ok {
+			label = fmt.Sprintf("%0.0f", score)
+		}
+		r.write(p, label, (i*7*dayWidth+i*2)+7*dayWidth/2, bottom+11, true, false)
+	}
+}
+
+// meterPatterns fill the sub-meters' parts of the bars in a meters panel,
+// in turn. The remainder is left white
+var meterPatterns = []func(x, y int) bool{
+	func(x, y int) bool { return true },
+	func(x, y int) bool { return (x+y)%4 < 2 },
+	func(x, y int) bool { return x%3 == 0 || y%3 == 0 },
+	func(x, y int) bool { return x%2 == 0 && y%2 == 0 },
+}
+
+// metersPanel shows each day's use split between the sub-meters and the
+// remainder, over the last Days days with readings, 7 by default
+func metersPanel(r *Renderer, p *Panel) {
+	meters := r.Power.Meters()
+	if len(meters) == 0 {
+		r.panelError(p, "No Sub-meters")
+		return
+	}
+	days := p.Days
+	if days <= 0 {
+		days = 7
+	}
+	history, ok := r.meterDays[days]
+	if !ok {
+		var err error
+		history, err = r.loadMeterDays(days)
+		if err != nil {
+			log.Println("meters:", err)
+		}
+		if r.meterDays == nil {
+			r.meterDays = make(map[int][]MeterDay)
+		}
+		r.meterDays[days] = history
+	}
+	if len(history) == 0 {
+		r.panelError(p, "No Data")
+		return
+	}
+
+	r.rect(p, 0, 0, p.Width, 20, image.Black)
+	r.write(p, "Usage by Meter", p.Width/2, 10, false, false)
+	top, bottom := 40, p.Height-42
+	most := 0.0
+	for _, d := range history {
+		total := 0.0
+		for _, amount := range d.Amounts {
+			total += amount
+		}
+		most = math.Max(most, total)
+	}
+	if most == 0 {
+		most = 1
+	}
+	dayWidth := p.Width / len(history)
+	fill := func(i, x1, y1, x2, y2 int) {
+		r.rect(p, x1, y1, x2, y2, image.Black)
+		if i == len(meters)-1 {
+			r.rect(p, x1+1, y1+1, x2-1, y2-1, image.White)
+			return
+		}
+		r.Screen.DrawPattern(p.X+x1+1, p.Y+y1+1, p.X+x2-1, p.Y+y2-1, meterPatterns[i%len(meterPatterns)])
+	}
+	for i, d := range history {
+		x := i*dayWidth + 3
+		y := bottom
+		total := 0.0
+		for j, meter := range meters {
+			amount := d.Amounts[meter]
+			total += amount
+			height := int(amount / most * float64(bottom-top))
+			if height < 2 {
+				continue
+			}
+			fill(j, x, y-height, x+dayWidth-6, y)
+			y -= height
+		}
+		if label := fmt.Sprintf("%.1f", total); r.Screen.TextWidth(label, false) < dayWidth {
+			r.write(p, label, x+(dayWidth-6)/2, y-9, true, false)
+		}
+		day := d.Day.Format("Mon")
+		if r.Screen.TextWidth(day, false) >= dayWidth {
+			day = day[:2]
+		}
+		r.write(p, day, x+(dayWidth-6)/2, bottom+11, true, false)
+	}
+	r.rect(p, 0, bottom, p.Width, bottom+1, image.Black)
+
+	// the legend is a swatch and the name of each meter along the bottom
+	x := 0
+	for i, meter := range meters {
+		fill(i, x, p.Height-16, x+12, p.Height-4)
+		width := r.Screen.TextWidth(meter, false)
+		r.write(p, meter, x+16+width/2, p.Height-10, true, false)
+		x += 16 + width + 12
+	}
+}
+
+// loadMeterDays reads the meters' use over the last days days with readings
+func (r *Renderer) loadMeterDays(days int) ([]MeterDay, error) {
+	latest, err := r.Power.LatestUsage()
+	if err != nil {
+		return nil, err
+	}
+	// the days end at the midnight after the last reading
+	end := r.Power.localDay(latest)
+	if end.Before(latest) {
+		end = end.AddDate(0, 0, 1)
+	}
+	return r.Power.MeterDays(end.AddDate(0, 0, -days), end)
+}
+
+// arrow draws a small up or down arrow centred on x, y
+func (r *Renderer) arrow(p *Panel, x, y int, up bool) {
+	for i := 0; i < 5; i++ {
+		row := y - 4 + i
+		if !up {
+			row = y + 4 - i
+		}
+		r.rect(p, x-i, row, x+i+1, row+1, image.Black)
+	}
+	if up {
+		r.rect(p, x-1, y+1, x+2, y+6, image.Black)
+	} else {
+		r.rect(p, x-1, y-5, x+2, y, image.Black)
+	}
+}
+
+// weatherPanel shows a single current weather value in large text. Style
+// "box" adds a secondary value in a black box underneath, "underline" just
+// draws a line under the value
+func weatherPanel(r *Renderer, p *Panel) {
+	w := r.Weather
+	if w == nil {
+		return
+	}
+	var value, secondary string
+	switch p.Source {
+	case "conditions":
+		value = w.Conditions()
+	case "wind":
+		value = w.WindSpeed() + "m/s (" + w.WindDirection() + ")"
+		secondary = w.WindGust() + "m/s gusts"
+	case "temp":
+		value = w.Temp() + "°C"
+		secondary = w.MaxTemp() + " / " + w.MinTemp() + "°C"
+	case "precipitation":
+		value = w.PrecipitationAmount() + "mm"
+		secondary = w.DayPrecipitationAmount() + "mm"
+	case "humidity":
+		value = w.Humidity() + "%"
+	case "uv":
+		value = "UV " + w.UV()
+	case "visibility":
+		value = w.Visibility() + w.VisibiltyDistance()
+	case "pressure":
+		value = w.Pressure()
+	}
+
+	x := p.Width / 2
+	r.write(p, value, x, 20, true, true)
+	switch p.Style {
+	case "box":
+		r.rect(p, 2, p.Height-25, p.Width-2, p.Height-5, image.Black)
+		r.write(p, secondary, x, p.Height-15, false, false)
+	case "underline":
+		r.Screen.DrawHorizontalLine(p.Y+p.Height-3, p.X+2, p.Width-4)
+	}
+}
+
+// forecastPanel shows the next five days, each in an 80px column
+func forecastPanel(r *Renderer, p *Panel) {
+	if r.Weather == nil {
+		return
+	}
+	x := 40
+	for _, f := range r.Weather.Forecast() {
+		weekcol := true
+		if f.Weekend {
+			r.rect(p, x-39, 20, x+39, 60, image.Black)
+			weekcol = false
+		} else {
+			r.rect(p, x-39, 0, x+39, 20, image.Black)
+		}
+		r.write(p, f.Date, x, 10, !weekcol, false)
+		r.write(p, f.TempMax+" / "+f.TempMin+"°C", x, 30, weekcol, false)
+		r.write(p, f.PrecipitationAmount+" mm", x, 50, weekcol, false)
+		x += 80
+	}
+}
+
+func weatherGraphPanel(r *Renderer, p *Panel) {
+	if r.Weather == nil {
+		r.write(p, "Cannot Contact Weather Service", p.Width/2, 40, true, false)
+		return
+	}
+	weatherGraph(r.Screen, r.Weather, p.X, p.Y)
+}
+
+func costGraphPanel(r *Renderer, p *Panel) {
+	if r.errs[PriceSource] != nil && len(r.prices) == 0 {
+		r.panelError(p, "No Price Data")
+		return
+	}
+	prices := r.prices
+	if p.Source == "hourly" {
+		prices = aggregatePrices(prices, time.Hour)
+	}
+	now := time.Now()
+	note := ""
+	if len(r.emissions) > 0 {
+		note = fmt.Sprintf("   CO2 max %.0fg", maxIntensity(r.emissions))
+	}
+	costGraph(r.Screen, prices, r.levels, r.priceStart, now, note, p.X, p.Y+p.Height, p.Width, p.Height)
+	if len(r.emissions) > 0 {
+		costGraphEmissions(r.Screen, r.emissions, r.priceStart, p.X, p.Y+p.Height, p.Width, p.Height)
+	}
+	if p.Length > 0 {
+		if best, err := cheapestWindow(r.prices, now, p.Length, time.Time{}); err == nil {
+			costGraphHighlight(r.Screen, best, r.priceStart, p.X, p.Y+p.Height, p.Width)
+		}
+	}
+}
+
+// cheapestPanel shows the cheapest run of Window, 3 hours by default, out
+// of the prices known, or with Hours set the cheapest hours
+func cheapestPanel(r *Renderer, p *Panel) {
+	if p.Hours > 0 {
+		cheapestHoursPanel(r, p)
+		return
+	}
+	window, length := p.Window, p.Length
+	if length == 0 {
+		window, length = "3h", 3*time.Hour
+	}
+	now := time.Now().In(r.Power.Location)
+	best, err := cheapestWindow(r.prices, now, length, time.Time{})
+	if err != nil {
+		r.panelError(p, "No Price Data")
+		return
+	}
+	start := best.Start.In(r.Power.Location).Format("15:04")
+	end := best.End.In(r.Power.Location).Format("15:04")
+	if best.Start.In(r.Power.Location).YearDay() != now.YearDay() {
+		start = best.Start.In(r.Power.Location).Format("Mon 15:04")
+	}
+	text := fmt.Sprintf("Best %s: %s–%s, avg %d øre", window, start, end, int(math.Round(best.Price*100)))
+	r.write(p, text, p.Width/2, p.Height/2, p.Style != "white", p.Large)
+}
+
+// cheapestHoursPanel lists the Hours cheapest hours out of the prices known,
+// with the hours next to each other joined up
+func cheapestHoursPanel(r *Renderer, p *Panel) {
+	now := time.Now().In(r.Power.Location)
+	hours, err := cheapestHours(r.prices, now, p.Hours, time.Time{})
+	if err != nil {
+		r.panelError(p, "No Price Data")
+		return
+	}
+	var runs []PriceInterval
+	sum := 0.0
+	for _, h := range hours {
+		sum += h.Price
+		if n := len(runs); n > 0 && runs[n-1].End.Equal(h.Start) {
+			runs[n-1].End = h.End
+			continue
+		}
+		runs = append(runs, h)
+	}
+	var spans []string
+	for _, run := range runs {
+		spans = append(spans, run.Start.In(r.Power.Location).Format("15")+"–"+run.End.In(r.Power.Location).Format("15"))
+	}
+	text := fmt.Sprintf("Best %dh: %s, avg %d øre", p.Hours, strings.Join(spans, " "), int(math.Round(sum/float64(len(hours))*100)))
+	r.write(p, text, p.Width/2, p.Height/2, p.Style != "white", p.Large)
+}
+
+// weatherGraph draws 48 hours of temperature, cloud cover and precipitation
+// in a 400x180 block with its top left corner at left, top
+func weatherGraph(screen *Screen, weather *Weather, left, top int) {
 	hours := weather.HourForecast()
 	max, min := 0, 0
 	for _, v := range hours {
@@ -165,7 +746,7 @@ func weatherGraph(screen *Screen, weather *Weather) {
 		max += 10
 	}
 
-	yMax, yMin := 350, 230
+	yMax, yMin := top+150, top+30
 	yDegree := (yMax - yMin) / (max - min)
 	yPivot := yMax
 	if max <= 0 {
@@ -173,17 +754,17 @@ func weatherGraph(screen *Screen, weather *Weather) {
 	} else if min < 0 {
 		yPivot -= yDegree * max
 	}
-	x := 50
+	x := left + 50
 	for i, v := range hours {
 		x += 7
 		// split out the days
 		if i > 0 && v.Hour == 0 {
 			x += 4
-			screen.DrawVerticalLine(x-5, 200, 180)
+			screen.DrawVerticalLine(x-5, top, 180)
 		}
 
 		if v.PrecipitationAmount > 0 {
-			screen.DrawRect(x-3, 375, x+4, 375-v.PrecipitationAmount*5, image.Black)
+			screen.DrawRect(x-3, top+175, x+4, top+175-v.PrecipitationAmount*5, image.Black)
 		}
 
 		y := yPivot - (v.Temperature*yDegree)/10
@@ -195,91 +776,257 @@ func weatherGraph(screen *Screen, weather *Weather) {
 
 		switch v.Sky {
 		case Broken:
-			screen.DrawRect(x-3, 205, x-2, 215, image.Black)
-			screen.DrawRect(x-1, 205, x, 215, image.Black)
-			screen.DrawRect(x+1, 205, x+2, 215, image.Black)
-			screen.DrawRect(x+3, 205, x+4, 215, image.Black)
+			screen.DrawRect(x-3, top+5, x-2, top+15, image.Black)
+			screen.DrawRect(x-1, top+5, x, top+15, image.Black)
+			screen.DrawRect(x+1, top+5, x+2, top+15, image.Black)
+			screen.DrawRect(x+3, top+5, x+4, top+15, image.Black)
 		case Cloudy:
-			screen.DrawRect(x-3, 205, x+4, 215, image.Black)
+			screen.DrawRect(x-3, top+5, x+4, top+15, image.Black)
 		case Fog:
-			screen.DrawRect(x-3, 205, x+4, 207, image.Black)
-			screen.DrawRect(x-3, 209, x+4, 211, image.Black)
-			screen.DrawRect(x-3, 213, x+4, 215, image.Black)
+			screen.DrawRect(x-3, top+5, x+4, top+7, image.Black)
+			screen.DrawRect(x-3, top+9, x+4, top+11, image.Black)
+			screen.DrawRect(x-3, top+13, x+4, top+15, image.Black)
 		}
 
 		switch v.Precipitation {
 		case LightRain:
-			screen.DrawRect(x-2, 215, x-1, 218, image.Black)
-			screen.DrawRect(x, 215, x+1, 217, image.Black)
-			screen.DrawRect(x+2, 215, x+3, 216, image.Black)
+			screen.DrawRect(x-2, top+15, x-1, top+18, image.Black)
+			screen.DrawRect(x, top+15, x+1, top+17, image.Black)
+			screen.DrawRect(x+2, top+15, x+3, top+16, image.Black)
 		case HeavyRain:
-			screen.DrawRect(x-2, 215, x-1, 222, image.Black)
-			screen.DrawRect(x, 215, x+1, 220, image.Black)
-			screen.DrawRect(x+2, 215, x+3, 218, image.Black)
+			screen.DrawRect(x-2, top+15, x-1, top+22, image.Black)
+			screen.DrawRect(x, top+15, x+1, top+20, image.Black)
+			screen.DrawRect(x+2, top+15, x+3, top+18, image.Black)
 		case LightSleet, LightSnow:
-			screen.DrawRect(x-3, 217, x, 218, image.Black)
-			screen.DrawRect(x-2, 216, x-1, 219, image.Black)
+			screen.DrawRect(x-3, top+17, x, top+18, image.Black)
+			screen.DrawRect(x-2, top+16, x-1, top+19, image.Black)
 		case HeavySleet, HeavySnow:
-			screen.DrawRect(x-3, 217, x, 218, image.Black)
-			screen.DrawRect(x-2, 216, x-1, 219, image.Black)
-			screen.DrawRect(x+1, 218, x+4, 219, image.Black)
-			screen.DrawRect(x+2, 217, x+3, 220, image.Black)
-			screen.DrawRect(x-1, 220, x+2, 221, image.Black)
-			screen.DrawRect(x, 219, x+1, 222, image.Black)
+			screen.DrawRect(x-3, top+17, x, top+18, image.Black)
+			screen.DrawRect(x-2, top+16, x-1, top+19, image.Black)
+			screen.DrawRect(x+1, top+18, x+4, top+19, image.Black)
+			screen.DrawRect(x+2, top+17, x+3, top+20, image.Black)
+			screen.DrawRect(x-1, top+20, x+2, top+21, image.Black)
+			screen.DrawRect(x, top+19, x+1, top+22, image.Black)
 		}
 
 	}
-	screen.Write("cover", 25, 210, true, false)
+	screen.Write("cover", left+25, top+10, true, false)
 	for degrees := min; degrees <= max; degrees += 10 {
 		if degrees == 0 {
-			screen.DrawThinBlackLine(yMax-(degrees-min)*yDegree+1, 50, 350)
+			screen.DrawThinBlackLine(yMax-(degrees-min)*yDegree+1, left+50, 350)
+		}
+		screen.DrawThinBlackLine(yMax-(degrees-min)*yDegree, left+50, 350)
+		screen.Write(strconv.Itoa(degrees)+"°C", left+25, yMax-(degrees-min)*yDegree, true, false)
+	}
+	screen.Write("precip", left+25, top+170, true, false)
+}
+
+// costGraphAxis is the space left of the cost graph's bars for its scale
+const costGraphAxis = 40
+
+// costGraph draws the prices for the two days from start as bars from a
+// zero baseline, up for positive prices and down for negative ones, in the
+// block at left, bottom. The scale is fitted to the prices and labelled down
+// the left hand side, with the lowest, highest and average price along the
+// top. Bars are placed by their times so that days with a daylight savings
+// change line up, and those already over at now are drawn thinner. When
+// levels are given each bar is filled with its level's pattern
+func costGraph(screen *Screen, prices []PriceInterval, levels *PriceLevels, start, now time.Time, note string, left, bottom, width, height int) {
+	if len(prices) == 0 {
+		return
+	}
+	xPos := costGraphX(start, left, width)
+	midnight := start.AddDate(0, 0, 1)
+
+	values := make([]int, len(prices))
+	min, max, sum := 0, 0, 0
+	for i, p := range prices {
+		values[i] = int(math.Round(p.Price * 100))
+		if i == 0 || values[i] < min {
+			min = values[i]
+		}
+		if i == 0 || values[i] > max {
+			max = values[i]
+		}
+		sum += values[i]
+	}
+	average := int(math.Round(float64(sum) / float64(len(values))))
+	annotation := fmt.Sprintf("min %d   avg %d   max %d øre", min, average, max) + note
+	screen.Write(annotation, left+width/2, bottom-height+10, true, false)
+
+	// the scale always includes zero and runs to whole steps either side
+	low, high := 0, 100
+	if min < low {
+		low = min
+	}
+	if max > high {
+		high = max
+	}
+	step := scaleStep(high - low)
+	low = int(math.Floor(float64(low)/float64(step))) * step
+	high = int(math.Ceil(float64(high)/float64(step))) * step
+	top := bottom - height + 30
+	bottom -= 2
+	yScale := float64(bottom-top) / float64(high-low)
+	yPos := func(value int) int {
+		return bottom - int(float64(value-low)*yScale)
+	}
+	zero := yPos(0)
+
+	for i, p := range prices {
+		x1, x2 := xPos(p.Start), xPos(p.End)
+		if p.Start.Before(midnight) && !p.End.Before(midnight) {
+			x2 -= 4
+		}
+		// leave a gap between wide bars, narrow ones are drawn touching so
+		// that the thin past ones stand out
+		if x2-x1 > 2 {
+			x2--
+		}
+		if !p.End.After(now) {
+			x1 = (x1+x2+1)/2 - 1
+			x2 = x1 + 1
+		}
+		y1, y2 := yPos(values[i]), zero
+		if values[i] < 0 {
+			y1, y2 = zero, y1
+		}
+		if levels == nil || x2-x1 < 2 {
+			screen.DrawRect(x1, y1, x2, y2, image.Black)
+		} else {
+			screen.DrawPattern(x1, y1, x2, y2, levelPattern(levels.Level(float64(values[i])), x1, y1, x2, y2))
+		}
+	}
+
+	right := xPos(start.AddDate(0, 0, 2))
+	for value := low; value <= high; value += step {
+		y := yPos(value)
+		label := strconv.Itoa(value)
+		screen.Write(label, left+costGraphAxis-5-screen.TextWidth(label, false)/2, y, true, false)
+		screen.DrawRect(left+costGraphAxis-4, y, left+costGraphAxis, y+1, image.Black)
+		// a white line through the bars at each step, like a ruler
+		if value != 0 {
+			screen.DrawRect(left+costGraphAxis, y, right, y+1, image.White)
+		}
+	}
+	screen.DrawRect(left+costGraphAxis, zero, right, zero+1, image.Black)
+	// the average is dashed across, white over the bars
+	y := yPos(average)
+	for x := left + costGraphAxis; x < right; x += 6 {
+		for dx := x; dx < x+3 && dx < right; dx++ {
+			colour := image.Black
+			if screen.Image.GrayAt(dx, y).Y < 128 {
+				colour = image.White
+			}
+			screen.DrawRect(dx, y, dx+1, y+1, colour)
 		}
-		screen.DrawThinBlackLine(yMax-(degrees-min)*yDegree, 50, 350)
-		screen.Write(strconv.Itoa(degrees)+"°C", 25, yMax-(degrees-min)*yDegree, true, false)
 	}
-	screen.Write("precip", 25, 370, true, false)
 }
 
-func costGraph(screen *Screen, power *Power) {
-	prices, pos := power.CostData()
-	// 48 hours shown, each bar has an 8 px slot to fit in with an 8px border
-	x := 400
-	max := 100
-	for i := 0; i < len(prices); i++ {
-		if prices[i] > max {
-			max = prices[i]
+// costGraphEmissions draws the CO2 emission intensity as a dotted line over
+// the cost graph, on its own scale from zero at the bottom up to the highest
+// figure
+func costGraphEmissions(screen *Screen, emissions []Emission, start time.Time, left, bottom, width, height int) {
+	xPos := costGraphX(start, left, width)
+	max := maxIntensity(emissions)
+	if max <= 0 {
+		return
+	}
+	top := bottom - height + 30
+	bottom -= 2
+	yPos := func(intensity float64) int {
+		return bottom - int(intensity/max*float64(bottom-top))
+	}
+	end := start.AddDate(0, 0, 2)
+	for _, e := range emissions {
+		if !e.End.After(start) || !e.Start.Before(end) {
+			continue
+		}
+		y := yPos(e.Intensity)
+		for x := xPos(e.Start); x < xPos(e.End); x++ {
+			if x%4 != 0 {
+				continue
+			}
+			// dots show up over the bars as well as between them
+			colour := image.Black
+			if screen.Image.GrayAt(x, y).Y < 128 {
+				colour = image.White
+			}
+			screen.DrawRect(x, y-1, x+2, y+1, colour)
+		}
+	}
+}
+
+func maxIntensity(emissions []Emission) float64 {
+	max := 0.0
+	for _, e := range emissions {
+		max = math.Max(max, e.Intensity)
+	}
+	return max
+}
+
+// levelPattern is the fill for a bar from x1, y1 to x2, y2 at a price level,
+// getting darker as the price goes up. Very cheap bars are only outlined,
+// narrow ones just top and bottom so that a run of them is outlined as one
+func levelPattern(level Level, x1, y1, x2, y2 int) func(x, y int) bool {
+	switch level {
+	case VeryCheap:
+		return func(x, y int) bool {
+			return y == y1 || y == y2-1 || (x2-x1 > 3 && (x == x1 || x == x2-1))
+		}
+	case Cheap:
+		return func(x, y int) bool {
+			return x%2 == 0 && y%2 == 0
+		}
+	case Normal:
+		return func(x, y int) bool {
+			return (x+y)%3 == 0
+		}
+	case Expensive:
+		return func(x, y int) bool {
+			return (x+y)%3 == 0 || (x-y)%3 == 0
 		}
 	}
-	// 240 is distance from 100 to 340
-	yScale := 240.0 / float64(max)
-	seperator := 2
-	// prices should be 48 hours...but daylight savings
-	for i := 0; i < len(prices); i++ {
-		x += 8
-		// offsets control width of bar
-		offset1 := 0
-		offset2 := 7
-		if i < pos {
-			offset1 = 3
-			offset2 = 4
+	return func(x, y int) bool { return true }
+}
+
+// scaleStep picks a round step that splits span into at most five parts
+func scaleStep(span int) int {
+	for step := 10; ; step *= 10 {
+		for _, s := range []int{step, step * 2, step * 5 / 2, step * 5} {
+			if span <= s*5 {
+				return s
+			}
 		}
+	}
+}
+
+// costGraphX returns where on the cost graph a time is drawn
+func costGraphX(start time.Time, left, width int) func(time.Time) int {
+	// 48 hours shown at up to 8 px an hour after the price scale, squeezed
+	// up on the 49 hour weekends when the clocks go back
+	midnight := start.AddDate(0, 0, 1)
+	hours := start.AddDate(0, 0, 2).Sub(start).Hours()
+	scale := 8.0
+	if hours*scale > float64(width-costGraphAxis-8) {
+		scale = float64(width-costGraphAxis-8) / hours
+	}
+	return func(t time.Time) int {
+		x := left + costGraphAxis + int(t.Sub(start).Hours()*scale)
 		// seperate out the two day blocks
-		if i == 24 {
+		if !t.Before(midnight) {
 			x += 4
 		}
-		value := prices[i]
-		y := 340 + seperator
-		for ; value >= 100; value -= 100 {
-			oldy := y - seperator
-			y -= int(100.0 * yScale)
-			screen.DrawRect(x+offset1, y, x+offset2, oldy, image.Black)
-		}
-		y -= seperator
-		newy := y - int(float64(value)*yScale)
-		screen.DrawRect(x+offset1, newy, x+offset2, y, image.Black)
+		return x
 	}
 }
 
+// costGraphHighlight marks a window under the cost graph's baseline
+func costGraphHighlight(screen *Screen, window PriceInterval, start time.Time, left, bottom, width int) {
+	xPos := costGraphX(start, left, width)
+	screen.DrawRect(xPos(window.Start), bottom+2, xPos(window.End)-1, bottom+5, image.Black)
+}
+
 func dateNow() string {
 	today := time.Now()
 	suffix := "th"
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"flag"
+	"image"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden images in testdata")
+
+// testScreen is a blank screen with the Go font, as the dashboard's own is
+// not in the repository
+func testScreen(t *testing.T, width, height int) *Screen {
+	t.Helper()
+	screen := NewScreen(width, height)
+	font, err := truetype.Parse(goregular.TTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	screen.Font = font
+	return screen
+}
+
+// checkGolden compares the screen with testdata/name, or rewrites it with
+// -update. A screen that differs is written to the temporary directory to
+// look at
+func checkGolden(t *testing.T, screen *Screen, name string) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		writePNG(t, path, screen.Image)
+		return
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	golden, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if golden.Bounds() != screen.Image.Bounds() {
+		t.Fatalf("%s is %v, drew %v", name, golden.Bounds(), screen.Image.Bounds())
+	}
+	differ := 0
+	bounds := golden.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r1, _, _, _ := golden.At(x, y).RGBA()
+			r2, _, _, _ := screen.Image.At(x, y).RGBA()
+			if r1 != r2 {
+				differ++
+			}
+		}
+	}
+	if differ > 0 {
+		got := filepath.Join(os.TempDir(), name)
+		writePNG(t, got, screen.Image)
+		t.Errorf("%d pixels differ from %s, drawn in %s", differ, path, got)
+	}
+}
+
+func writePNG(t *testing.T, path string, img image.Image) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = png.Encode(f, img); err != nil {
+		f.Close()
+		t.Fatal(err)
+	}
+	if err = f.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCostGraphXDaylightSaving(t *testing.T) {
+	loc := copenhagen(t)
+	date := func(month time.Month, day, hour, min int) time.Time {
+		return time.Date(2026, month, day, hour, min, 0, 0, loc)
+	}
+	// 600 wide leaves room for 8 px an hour, 2 px a quarter, with the
+	// second day 4 px further right
+	tests := []struct {
+		name  string
+		start time.Time
+		t     time.Time
+		x     int
+	}{
+		{"first bar", date(1, 18, 0, 0), date(1, 18, 0, 0), 40},
+		{"last bar of the first day", date(1, 18, 0, 0), date(1, 18, 23, 45), 40 + 190},
+		{"first bar of the second day", date(1, 18, 0, 0), date(1, 19, 0, 0), 40 + 192 + 4},
+		{"end", date(1, 18, 0, 0), date(1, 20, 0, 0), 40 + 384 + 4},
+
+		// 02:00 to 03:00 is skipped on 29 March
+		{"before spring forward", date(3, 29, 0, 0), date(3, 29, 1, 45), 40 + 14},
+		{"after spring forward", date(3, 29, 0, 0), date(3, 29, 3, 0), 40 + 16},
+		{"after the short day", date(3, 29, 0, 0), date(3, 30, 0, 0), 40 + 184 + 4},
+		{"end after the short day", date(3, 29, 0, 0), date(3, 31, 0, 0), 40 + 376 + 4},
+		{"short second day", date(3, 28, 0, 0), date(3, 29, 3, 0), 40 + 208 + 4},
+		{"end of the short second day", date(3, 28, 0, 0), date(3, 30, 0, 0), 40 + 376 + 4},
+
+		// 02:00 to 03:00 comes twice on 25 October
+		{"first 02:00", date(10, 25, 0, 0), date(10, 25, 1, 0).Add(time.Hour), 40 + 16},
+		{"second 02:00", date(10, 25, 0, 0), date(10, 25, 1, 0).Add(2 * time.Hour), 40 + 24},
+		{"after the long day", date(10, 25, 0, 0), date(10, 26, 0, 0), 40 + 200 + 4},
+		{"end after the long day", date(10, 25, 0, 0), date(10, 27, 0, 0), 40 + 392 + 4},
+		{"long second day", date(10, 24, 0, 0), date(10, 25, 3, 0), 40 + 224 + 4},
+	}
+	for _, test := range tests {
+		xPos := costGraphX(test.start, 0, 600)
+		if x := xPos(test.t); x != test.x {
+			t.Errorf("%s: %s drawn at %d, want %d", test.name, test.t.Format("2 Jan 15:04 MST"), x, test.x)
+		}
+	}
+}
+
+func TestCostGraphXSqueezed(t *testing.T) {
+	loc := copenhagen(t)
+	// the two days must fit between the scale and the right hand edge, and
+	// the bars either side of midnight are kept apart
+	for _, start := range []time.Time{
+		time.Date(2026, 1, 18, 0, 0, 0, 0, loc),
+		time.Date(2026, 3, 29, 0, 0, 0, 0, loc),
+		time.Date(2026, 10, 24, 0, 0, 0, 0, loc),
+		time.Date(2026, 10, 25, 0, 0, 0, 0, loc),
+	} {
+		left, width := 400, 400
+		xPos := costGraphX(start, left, width)
+		midnight := start.AddDate(0, 0, 1)
+		if x := xPos(start); x != left+costGraphAxis {
+			t.Errorf("%s starts at %d", start, x)
+		}
+		if x := xPos(start.AddDate(0, 0, 2)); x > left+width-4 {
+			t.Errorf("%s ends at %d, past %d", start, x, left+width-4)
+		}
+		// costGraph draws the last bar of the first day 4 px short
+		last := xPos(midnight.Add(-15 * time.Minute))
+		if end := xPos(midnight) - 4; end <= last || end > last+8 {
+			t.Errorf("%s: last bar of the first day from %d to %d", start, last, end)
+		}
+		if first, next := xPos(midnight), xPos(midnight.Add(15*time.Minute)); next <= first {
+			t.Errorf("%s: first bar of the second day from %d to %d", start, first, next)
+		}
+	}
+}
+
+// quarterPrices are two days of 15 minute prices from start, in DKK/kWh
+func quarterPrices(start time.Time, price func(i int) float64) []PriceInterval {
+	var prices []PriceInterval
+	for i := 0; i < 2*96; i++ {
+		from := start.Add(time.Duration(i) * 15 * time.Minute)
+		prices = append(prices, PriceInterval{Start: from, End: from.Add(15 * time.Minute), Price: price(i)})
+	}
+	return prices
+}
+
+func TestCostGraphGolden(t *testing.T) {
+	start := time.Date(2026, 1, 18, 0, 0, 0, 0, copenhagen(t))
+	// a day's swing, cheapest at night
+	daily := func(i int) float64 {
+		return math.Sin(2 * math.Pi * float64(i-24) / 96)
+	}
+	tests := []struct {
+		name   string
+		prices []PriceInterval
+		levels *PriceLevels
+	}{
+		{"costgraph-positive.png", quarterPrices(start, func(i int) float64 {
+			return 0.9 + 0.5*daily(i)
+		}), &PriceLevels{60, 80, 110, 130}},
+		{"costgraph-negative.png", quarterPrices(start, func(i int) float64 {
+			return 0.3 + 0.6*daily(i)
+		}), &PriceLevels{0, 20, 50, 70}},
+		{"costgraph-spike.png", quarterPrices(start, func(i int) float64 {
+			if i == 140 {
+				return 30
+			}
+			return 0.9 + 0.5*daily(i)
+		}), nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// with room on the left for the scale's labels
+			screen := testScreen(t, 440, 240)
+			now := start.Add(30 * time.Hour)
+			costGraph(screen, test.prices, test.levels, start, now, "", 40, 240, 400, 228)
+			checkGolden(t, screen, test.name)
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// budgetDays is how many days back the daily average the month is projected
+// from goes
+const budgetDays = 7
+
+// budgetMinSpan is the least usage the daily average is taken from
+const budgetMinSpan = 24 * time.Hour
+
+// Budget is the month's spending so far against the monthly budget, in DKK
+type Budget struct {
+	Limit float64
+	Spent float64
+	// Projected is Spent plus the recent daily average for the rest of the
+	// month
+	Projected float64
+	// Through is the end of the last reading counted
+	Through time.Time
+}
+
+// Over is whether the spending has gone past the budget
+func (b Budget) Over() bool {
+	return b.Spent > b.Limit
+}
+
+// Budget works out the spending this month as of now against limit
+func (power *Power) Budget(limit float64, now time.Time) (Budget, error) {
+	budget := Budget{Limit: limit}
+	now = now.In(power.Location)
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, power.Location)
+	end := start.AddDate(0, 1, 0)
+	month, err := power.Summarize(start, now)
+	if err != nil {
+		return budget, err
+	}
+	budget.Spent = month.Cost
+	budget.Through = month.To
+
+	// readings come in a day or so late, so the average is taken back from
+	// the last one rather than now
+	latest, err := power.LatestUsage()
+	if err != nil {
+		return budget, err
+	}
+	if latest.After(now) {
+		latest = now
+	}
+	readings, err := power.UsageBetween(latest.AddDate(0, 0, -budgetDays), latest)
+	if err != nil {
+		return budget, err
+	}
+	if len(readings) == 0 {
+		return budget, errors.New("no recent usage to project the month from")
+	}
+	// a meter read for less than the whole week is averaged over the days
+	// it has readings for
+	recent, err := power.Summarize(readings[0].Start, latest)
+	if err != nil {
+		return budget, err
+	}
+	covered := recent.To.Sub(recent.From)
+	if covered < budgetMinSpan {
+		return budget, fmt.Errorf("only %s of recent usage to project the month from", covered)
+	}
+	daily := recent.Cost / (covered.Hours() / 24)
+	left := end.Sub(budget.Through).Hours() / 24
+	budget.Projected = budget.Spent + daily*left
+	return budget, nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBudgetProjection(t *testing.T) {
+	loc := copenhagen(t)
+	date := func(day, hour int) time.Time {
+		return time.Date(2026, 1, day, hour, 0, 0, 0, loc)
+	}
+	now := date(18, 12)
+	tests := []struct {
+		name      string
+		from      time.Time
+		spent     float64
+		projected float64
+	}{
+		// at 1 kWh an hour for 1 DKK/kWh the month goes on at 24 DKK a day,
+		// for the 14 days from the last reading
+		{"a week of readings", date(8, 0), 240, 240 + 24*14},
+		{"two days of readings", date(16, 0), 48, 48 + 24*14},
+		{"a day of readings", date(17, 0), 24, 24 + 24*14},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			power := testPower(t, loc)
+			storeSteps(t, power, date(1, 0), date(19, 0), time.Hour)
+			storeHourlyUsage(t, power, test.from, date(18, 0))
+			budget, err := power.Budget(500, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !near(budget.Spent, test.spent) || !near(budget.Projected, test.projected) {
+				t.Errorf("spent %.2f projecting %.2f, want %.2f projecting %.2f", budget.Spent, budget.Projected, test.spent, test.projected)
+			}
+			if !budget.Through.Equal(date(18, 0)) {
+				t.Errorf("through %s", budget.Through)
+			}
+		})
+	}
+}
+
+func TestBudgetTooLittleUsage(t *testing.T) {
+	loc := copenhagen(t)
+	date := func(day, hour int) time.Time {
+		return time.Date(2026, 1, day, hour, 0, 0, 0, loc)
+	}
+	power := testPower(t, loc)
+	if _, err := power.Budget(500, date(18, 12)); err == nil {
+		t.Error("no error without usage")
+	}
+	storeSteps(t, power, date(17, 0), date(19, 0), time.Hour)
+	storeHourlyUsage(t, power, date(17, 18), date(18, 0))
+	if _, err := power.Budget(500, date(18, 12)); err == nil {
+		t.Error("projected the month from 6 hours of usage")
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ErrNoWindow is returned when the known prices cannot fit what was asked for
+var ErrNoWindow = errors.New("not enough prices known")
+
+// cheapestWindow finds the cheapest contiguous run of length in sorted
+// prices. Runs start at the beginning of an interval and can start in the
+// one now is in, so a window that has begun is still shown
+func cheapestWindow(prices []PriceInterval, now time.Time, length time.Duration, deadline time.Time) (PriceInterval, error) {
+	var best PriceInterval
+	found := false
+	for i := range prices {
+		if !prices[i].End.After(now) {
+			continue
+		}
+		window := PriceInterval{Start: prices[i].Start, End: prices[i].Start.Add(length)}
+		if !deadline.IsZero() && window.End.After(deadline) {
+			break
+		}
+		var covered time.Duration
+		sum := 0.0
+		for j := i; j < len(prices) && covered < length; j++ {
+			if j > i && !prices[j].Start.Equal(prices[j-1].End) {
+				break
+			}
+			used := prices[j].End.Sub(prices[j].Start)
+			if covered+used > length {
+				used = length - covered
+			}
+			covered += used
+			sum += prices[j].Price * float64(used)
+		}
+		if covered < length {
+			continue
+		}
+		window.Price = sum / float64(length)
+		if !found || window.Price < best.Price {
+			best = window
+			found = true
+		}
+	}
+	if !found {
+		return best, fmt.Errorf("%w for %s", ErrNoWindow, length)
+	}
+	return best, nil
+}
+
+// cheapestHours picks the n cheapest whole hours that have not finished by
+// now and are over by deadline, in time order
+func cheapestHours(prices []PriceInterval, now time.Time, n int, deadline time.Time) ([]PriceInterval, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("cannot pick %d hours", n)
+	}
+	var hours []PriceInterval
+	for _, hour := range aggregatePrices(prices, time.Hour) {
+		if !hour.End.After(now) || (!deadline.IsZero() && hour.End.After(deadline)) {
+			continue
+		}
+		hours = append(hours, hour)
+	}
+	if len(hours) < n {
+		return nil, fmt.Errorf("%w for %d hours", ErrNoWindow, n)
+	}
+	sort.SliceStable(hours, func(i, j int) bool {
+		return hours[i].Price < hours[j].Price
+	})
+	hours = hours[:n]
+	sort.Slice(hours, func(i, j int) bool {
+		return hours[i].Start.Before(hours[j].Start)
+	})
+	return hours, nil
+}
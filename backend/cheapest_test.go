@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// pricesFrom makes back to back intervals of step from start, one for each
+// price in øre/kWh
+func pricesFrom(start time.Time, step time.Duration, ore ...float64) []PriceInterval {
+	prices := make([]PriceInterval, len(ore))
+	for i, p := range ore {
+		prices[i] = PriceInterval{Start: start.Add(time.Duration(i) * step), End: start.Add(time.Duration(i+1) * step), Price: p / 100}
+	}
+	return prices
+}
+
+func TestCheapestWindow(t *testing.T) {
+	at := func(hour, min int) time.Time {
+		return time.Date(2026, 1, 18, hour, min, 0, 0, time.UTC)
+	}
+	day := pricesFrom(at(0, 0), time.Hour,
+		60, 50, 40, 30, 35, 45, 80, 120, 150, 110, 90, 70,
+		65, 60, 75, 95, 140, 180, 160, 120, 90, 80, 70, 65)
+	// the hour from 8 is missing
+	gap := append(append([]PriceInterval(nil), day[:8]...), day[9:]...)
+	gap[9].Price, gap[10].Price, gap[11].Price = 0.1, 0.1, 0.1
+	tests := []struct {
+		name     string
+		prices   []PriceInterval
+		now      time.Time
+		length   time.Duration
+		deadline time.Time
+		start    time.Time
+		average  float64
+	}{
+		{"normal day", day, at(0, 0), 3 * time.Hour, time.Time{}, at(2, 0), 35},
+		{"an hour", day, at(0, 0), time.Hour, time.Time{}, at(3, 0), 30},
+		// the run can start in the hour now is in, not one that is over
+		{"started", day, at(3, 30), 3 * time.Hour, time.Time{}, at(3, 0), 110.0 / 3},
+		{"past the cheapest", day, at(6, 0), 3 * time.Hour, time.Time{}, at(11, 0), 65},
+		{"deadline", day, at(6, 0), 2 * time.Hour, at(14, 0), at(12, 0), 62.5},
+		{"part of an hour", day, at(0, 0), 90 * time.Minute, time.Time{}, at(3, 0), 95.0 / 3},
+		// the cheap hours after the gap are used, but no window spans it
+		{"gap", gap, at(0, 0), 3 * time.Hour, time.Time{}, at(10, 0), 10},
+		{"across the gap", gap, at(6, 0), 4 * time.Hour, at(11, 0), time.Time{}, 0},
+		{"15 minute steps", pricesFrom(at(0, 0), 15*time.Minute, 50, 40, 20, 10, 30, 60, 20, 90), at(0, 0), 45 * time.Minute, time.Time{}, at(0, 30), 20},
+		{"15 minute steps, started", pricesFrom(at(0, 0), 15*time.Minute, 50, 40, 20, 10, 30, 60, 20, 90), at(0, 50), 30 * time.Minute, time.Time{}, at(0, 45), 20},
+		{"longer than known", day[20:], at(20, 0), 5 * time.Hour, time.Time{}, time.Time{}, 0},
+		{"no prices", nil, at(0, 0), time.Hour, time.Time{}, time.Time{}, 0},
+	}
+	for _, test := range tests {
+		best, err := cheapestWindow(test.prices, test.now, test.length, test.deadline)
+		if test.start.IsZero() {
+			if !errors.Is(err, ErrNoWindow) {
+				t.Errorf("%s: got %+v, %v, want ErrNoWindow", test.name, best, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !best.Start.Equal(test.start) || !best.End.Equal(test.start.Add(test.length)) || !near(best.Price*100, test.average) {
+			t.Errorf("%s: got %s until %s at %.2f, want from %s at %.2f", test.name, best.Start, best.End, best.Price*100, test.start, test.average)
+		}
+	}
+}
+
+func TestCheapestHours(t *testing.T) {
+	at := func(hour, min int) time.Time {
+		return time.Date(2026, 1, 18, hour, min, 0, 0, time.UTC)
+	}
+	day := pricesFrom(at(0, 0), time.Hour, 60, 50, 40, 30, 35, 45, 80, 20, 150, 25)
+	quarters := pricesFrom(at(0, 0), 15*time.Minute,
+		50, 50, 50, 50,
+		10, 20, 30, 40,
+		90, 90, 90, 90,
+		5, 5, 10, 10)
+	tests := []struct {
+		name     string
+		prices   []PriceInterval
+		now      time.Time
+		n        int
+		deadline time.Time
+		starts   []int
+	}{
+		{"normal day", day, at(0, 0), 3, time.Time{}, []int{3, 7, 9}},
+		{"back to back", day, at(0, 0), 5, time.Time{}, []int{2, 3, 4, 7, 9}},
+		{"started", day, at(7, 30), 2, time.Time{}, []int{7, 9}},
+		{"finished", day, at(8, 0), 2, time.Time{}, []int{8, 9}},
+		{"deadline", day, at(0, 0), 2, at(6, 0), []int{3, 4}},
+		// the missing hour is not picked
+		{"gap", append(append([]PriceInterval(nil), day[:7]...), day[8:]...), at(0, 0), 2, time.Time{}, []int{3, 9}},
+		{"15 minute steps", quarters, at(0, 0), 2, time.Time{}, []int{1, 3}},
+		{"more than known", day, at(5, 0), 6, time.Time{}, nil},
+	}
+	for _, test := range tests {
+		hours, err := cheapestHours(test.prices, test.now, test.n, test.deadline)
+		if test.starts == nil {
+			if !errors.Is(err, ErrNoWindow) {
+				t.Errorf("%s: got %v, %v, want ErrNoWindow", test.name, hours, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if len(hours) != len(test.starts) {
+			t.Errorf("%s: got %v, want hours from %v", test.name, hours, test.starts)
+			continue
+		}
+		for i, h := range hours {
+			if !h.Start.Equal(at(test.starts[i], 0)) || !h.End.Equal(at(test.starts[i]+1, 0)) {
+				t.Errorf("%s: got %v, want hours from %v", test.name, hours, test.starts)
+				break
+			}
+		}
+	}
+
+	// the quarter hours are averaged
+	hours, _ := cheapestHours(quarters, at(0, 0), 1, time.Time{})
+	if len(hours) != 1 || !near(hours[0].Price*100, 7.5) {
+		t.Errorf("got %v, want 7.5 øre from 3", hours)
+	}
+	for _, n := range []int{0, -1} {
+		if _, err := cheapestHours(day, at(0, 0), n, time.Time{}); err == nil {
+			t.Errorf("no error picking %d hours", n)
+		}
+	}
+}
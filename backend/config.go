@@ -0,0 +1,535 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the settings that differ between machines. Values are read,
+// lowest precedence first, from the defaults, a JSON config file, DISPLAY_*
+// environment variables and finally command line flags
+type Config struct {
+	Database    string
+	Latitude    string
+	Longitude   string
+	Weather     string
+	TimeZone    string
+	Font        string
+	Layout      string
+	FullImage   string
+	OutputImage string
+	// Panel is the SPI device the panel is on, when empty the image is only
+	// written to OutputImage
+	Panel    string
+	GPIOChip string
+	// RefreshState is where the number of partial refreshes since the last
+	// full one is kept between runs
+	RefreshState     string
+	FullRefreshEvery int
+	PartialMaxArea   float64
+
+	// PriceArea is the bidding area prices are fetched for, e.g. DK1. When
+	// empty prices are not fetched
+	PriceArea    string
+	PriceDataset string
+	// PriceResolution is the length of the price intervals stored, e.g.
+	// 15m or 1h
+	PriceResolution string
+	// PriceTariff and PriceTransmission are flat amounts added to the spot
+	// price along with Tariffs, in DKK/kWh, then PriceVAT percent on top
+	PriceTariff       float64
+	PriceTransmission float64
+	PriceVAT          float64
+	// Tariffs are the grid tariffs, taxes and fees, only set in the config
+	// file
+	Tariffs []Tariff
+	// ExportFee and ExportTariffs are taken off the spot price for
+	// electricity fed into the grid, in DKK/kWh
+	ExportFee     float64
+	ExportTariffs []Tariff
+	// CO2 fetches the CO2 emission intensity for PriceArea along with the
+	// prices
+	CO2 bool
+	// PriceThresholds are the four comma separated prices in øre/kWh between
+	// very cheap, cheap, normal, expensive and very expensive. When empty the
+	// levels are relative to the last week's prices
+	PriceThresholds string
+
+	// Budget is the monthly electricity budget in DKK, 0 for none
+	Budget float64
+
+	// EloverblikToken is the refresh token usage is imported with, when empty
+	// usage is not imported
+	EloverblikToken string
+	MeteringPoint   string
+	// ExportMeteringPoint is the metering point for export, when empty no
+	// export is imported
+	ExportMeteringPoint string
+	// SubMeters are meters behind the main one, e.g. for a heat pump or an
+	// EV charger, only set in the config file
+	SubMeters []SubMeter
+
+	// NotifyService is ntfy or gotify, notifications are posted to
+	// NotifyURL with NotifyToken. When empty they are only mailed, if
+	// SMTPServer is set
+	NotifyService string
+	NotifyURL     string
+	NotifyToken   string
+	// SMTPServer is the host:port notifications are mailed through, from
+	// MailFrom to the comma separated MailTo
+	SMTPServer   string
+	SMTPUser     string
+	SMTPPassword string
+	MailFrom     string
+	MailTo       string
+	// AlertAbove, AlertNegative and AlertWindow are what tomorrow's prices
+	// are notified of, see AlertRules
+	AlertAbove    float64
+	AlertNegative bool
+	AlertWindow   string
+
+	// HANDevice is the serial device the meter's HAN port is on, e.g.
+	// /dev/ttyUSB0, when empty the meter is not read
+	HANDevice string
+	HANBaud   int
+	// HANKey and HANAuthKey are the hex encryption and authentication keys
+	// from the grid company, for meters that encrypt their messages
+	HANKey     string
+	HANAuthKey string
+	// HANEnergyUnit is the Wh in each step of the meter's energy registers
+	HANEnergyUnit float64
+
+	// Daemon keeps running and refreshes each part of the display on its
+	// own schedule
+	Daemon          bool
+	WeatherInterval string
+	// UsageHour is the hour of the day the usage figures are reloaded
+	UsageHour int
+
+	// Args are the command line arguments left after the flags
+	Args []string `json:"-"`
+	// Location is TimeZone once loaded, set by Validate
+	Location *time.Location `json:"-"`
+	// WeatherEvery is WeatherInterval once parsed, set by Validate
+	WeatherEvery time.Duration `json:"-"`
+	// PriceStep is PriceResolution once parsed, set by Validate
+	PriceStep time.Duration `json:"-"`
+	// Thresholds is PriceThresholds once parsed, set by Validate
+	Thresholds []float64 `json:"-"`
+	// AlertLength is AlertWindow once parsed, set by Validate
+	AlertLength time.Duration `json:"-"`
+	// HANCipherKey and HANAuthenticationKey are HANKey and HANAuthKey once
+	// decoded, set by Validate
+	HANCipherKey         []byte `json:"-"`
+	HANAuthenticationKey []byte `json:"-"`
+}
+
+type setting struct {
+	name  string
+	env   string
+	usage string
+	value flag.Value
+}
+
+type stringValue struct{ p *string }
+
+func (v stringValue) String() string {
+	if v.p == nil {
+		return ""
+	}
+	return *v.p
+}
+
+func (v stringValue) Set(s string) error {
+	*v.p = s
+	return nil
+}
+
+type intValue struct{ p *int }
+
+func (v intValue) String() string {
+	if v.p == nil {
+		return "0"
+	}
+	return strconv.Itoa(*v.p)
+}
+
+func (v intValue) Set(s string) error {
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		return err
+	}
+	*v.p = i
+	return nil
+}
+
+type boolValue struct{ p *bool }
+
+func (v boolValue) String() string {
+	if v.p == nil {
+		return "false"
+	}
+	return strconv.FormatBool(*v.p)
+}
+
+func (v boolValue) Set(s string) error {
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	*v.p = b
+	return nil
+}
+
+func (v boolValue) IsBoolFlag() bool { return true }
+
+type floatValue struct{ p *float64 }
+
+func (v floatValue) String() string {
+	if v.p == nil {
+		return "0"
+	}
+	return strconv.FormatFloat(*v.p, 'g', -1, 64)
+}
+
+func (v floatValue) Set(s string) error {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return err
+	}
+	*v.p = f
+	return nil
+}
+
+func defaultConfig() *Config {
+	return &Config{
+		Database:    "electricity.db",
+		Latitude:    "55.7034",
+		Longitude:   "12.5823",
+		Weather:     "dmi",
+		TimeZone:    "Europe/Copenhagen",
+		Font:        "fonts/FontsFree-Net-HelveticaNeueMedium.ttf",
+		Layout:      "layout.json",
+		FullImage:   "full.bmp",
+		OutputImage: "out.bmp",
+		GPIOChip:    "/dev/gpiochip0",
+
+		RefreshState:     "refresh.state",
+		FullRefreshEvery: 10,
+		PartialMaxArea:   0.5,
+
+		PriceDataset:    "DayAheadPrices",
+		PriceResolution: "15m",
+
+		HANBaud:       2400,
+		HANEnergyUnit: 10,
+
+		WeatherInterval: "30m",
+		UsageHour:       6,
+	}
+}
+
+func (config *Config) settings() []setting {
+	return []setting{
+		{"db", "DISPLAY_DATABASE", "path to the electricity sqlite database", stringValue{&config.Database}},
+		{"lat", "DISPLAY_LATITUDE", "latitude for the weather forecast", stringValue{&config.Latitude}},
+		{"lon", "DISPLAY_LONGITUDE", "longitude for the weather forecast", stringValue{&config.Longitude}},
+		{"weather", "DISPLAY_WEATHER", "weather provider, dmi or open-meteo", stringValue{&config.Weather}},
+		{"tz", "DISPLAY_TIMEZONE", "time zone the electricity data is in", stringValue{&config.TimeZone}},
+		{"font", "DISPLAY_FONT", "path to the TrueType font", stringValue{&config.Font}},
+		{"layout", "DISPLAY_LAYOUT", "path to the JSON layout file", stringValue{&config.Layout}},
+		{"full", "DISPLAY_FULL_IMAGE", "where to write the greyscale bmp", stringValue{&config.FullImage}},
+		{"out", "DISPLAY_OUTPUT_IMAGE", "where to write the one bit image", stringValue{&config.OutputImage}},
+		{"panel", "DISPLAY_PANEL", "SPI device to drive the panel through, e.g. /dev/spidev0.0", stringValue{&config.Panel}},
+		{"gpio", "DISPLAY_GPIO_CHIP", "GPIO chip the panel's control pins are on", stringValue{&config.GPIOChip}},
+		{"state", "DISPLAY_REFRESH_STATE", "file to keep the partial refresh count in", stringValue{&config.RefreshState}},
+		{"full-every", "DISPLAY_FULL_REFRESH_EVERY", "partial refreshes before a full one", intValue{&config.FullRefreshEvery}},
+		{"partial-area", "DISPLAY_PARTIAL_MAX_AREA", "fraction of the screen that can change in a partial refresh", floatValue{&config.PartialMaxArea}},
+		{"area", "DISPLAY_PRICE_AREA", "bidding area to fetch prices for, e.g. DK1", stringValue{&config.PriceArea}},
+		{"dataset", "DISPLAY_PRICE_DATASET", "Energi Data Service dataset, DayAheadPrices or Elspotprices", stringValue{&config.PriceDataset}},
+		{"resolution", "DISPLAY_PRICE_RESOLUTION", "length of the stored price intervals, 15m, 30m or 1h", stringValue{&config.PriceResolution}},
+		{"tariff", "DISPLAY_PRICE_TARIFF", "flat tariff added to spot prices in DKK/kWh", floatValue{&config.PriceTariff}},
+		{"transmission", "DISPLAY_PRICE_TRANSMISSION", "transmission fee added to spot prices in DKK/kWh", floatValue{&config.PriceTransmission}},
+		{"vat", "DISPLAY_PRICE_VAT", "VAT percentage added to prices", floatValue{&config.PriceVAT}},
+		{"export-fee", "DISPLAY_EXPORT_FEE", "fee taken off spot prices for export in DKK/kWh", floatValue{&config.ExportFee}},
+		{"co2", "DISPLAY_CO2", "fetch the CO2 emission intensity along with prices", boolValue{&config.CO2}},
+		{"thresholds", "DISPLAY_PRICE_THRESHOLDS", "comma separated øre/kWh limits between the five price levels", stringValue{&config.PriceThresholds}},
+		{"budget", "DISPLAY_BUDGET", "monthly electricity budget in DKK", floatValue{&config.Budget}},
+		{"eloverblik-token", "DISPLAY_ELOVERBLIK_TOKEN", "eloverblik.dk refresh token to import usage with", stringValue{&config.EloverblikToken}},
+		{"metering-point", "DISPLAY_METERING_POINT", "metering point id to import, defaults to the first", stringValue{&config.MeteringPoint}},
+		{"export-point", "DISPLAY_EXPORT_METERING_POINT", "metering point id for export to the grid", stringValue{&config.ExportMeteringPoint}},
+		{"notify", "DISPLAY_NOTIFY_SERVICE", "notification service, ntfy or gotify", stringValue{&config.NotifyService}},
+		{"notify-url", "DISPLAY_NOTIFY_URL", "ntfy topic or Gotify server URL", stringValue{&config.NotifyURL}},
+		{"notify-token", "DISPLAY_NOTIFY_TOKEN", "access token for the notification service", stringValue{&config.NotifyToken}},
+		{"smtp", "DISPLAY_SMTP_SERVER", "host:port of the SMTP server to mail notifications through", stringValue{&config.SMTPServer}},
+		{"smtp-user", "DISPLAY_SMTP_USER", "SMTP user name", stringValue{&config.SMTPUser}},
+		{"smtp-password", "DISPLAY_SMTP_PASSWORD", "SMTP password", stringValue{&config.SMTPPassword}},
+		{"mail-from", "DISPLAY_MAIL_FROM", "address notifications are mailed from", stringValue{&config.MailFrom}},
+		{"mail-to", "DISPLAY_MAIL_TO", "comma separated addresses to mail notifications to", stringValue{&config.MailTo}},
+		{"alert-above", "DISPLAY_ALERT_ABOVE", "notify of hours tomorrow above this price in øre/kWh", floatValue{&config.AlertAbove}},
+		{"alert-negative", "DISPLAY_ALERT_NEGATIVE", "notify of negative spot prices tomorrow", boolValue{&config.AlertNegative}},
+		{"alert-window", "DISPLAY_ALERT_WINDOW", "notify of the cheapest run of this length tomorrow, e.g. 3h", stringValue{&config.AlertWindow}},
+		{"han", "DISPLAY_HAN_DEVICE", "serial device of the meter's HAN port, e.g. /dev/ttyUSB0", stringValue{&config.HANDevice}},
+		{"han-baud", "DISPLAY_HAN_BAUD", "baud rate of the HAN port", intValue{&config.HANBaud}},
+		{"han-key", "DISPLAY_HAN_KEY", "hex encryption key for the meter's messages", stringValue{&config.HANKey}},
+		{"han-auth-key", "DISPLAY_HAN_AUTH_KEY", "hex authentication key for the meter's messages", stringValue{&config.HANAuthKey}},
+		{"han-energy-unit", "DISPLAY_HAN_ENERGY_UNIT", "Wh per step of the meter's energy registers", floatValue{&config.HANEnergyUnit}},
+		{"daemon", "DISPLAY_DAEMON", "keep running and refresh the display on a schedule", boolValue{&config.Daemon}},
+		{"weather-every", "DISPLAY_WEATHER_INTERVAL", "how often to fetch the weather in daemon mode", stringValue{&config.WeatherInterval}},
+		{"usage-hour", "DISPLAY_USAGE_HOUR", "hour of the day to reload usage in daemon mode", intValue{&config.UsageHour}},
+	}
+}
+
+// LoadConfig builds the config from the file given by -config (or
+// DISPLAY_CONFIG), the environment and the command line arguments
+func LoadConfig(args []string) (*Config, error) {
+	config := defaultConfig()
+
+	flags := flag.NewFlagSet("display", flag.ContinueOnError)
+	path := flags.String("config", "", "path to the JSON config file (env DISPLAY_CONFIG)")
+	// flags are parsed into a separate copy so that they can be applied last
+	fromFlags := defaultConfig()
+	for _, s := range fromFlags.settings() {
+		flags.Var(s.value, s.name, s.usage+" (env "+s.env+")")
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if *path == "" {
+		*path = os.Getenv("DISPLAY_CONFIG")
+	}
+	if *path != "" {
+		if err := config.readFile(*path); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, s := range config.settings() {
+		if v, ok := os.LookupEnv(s.env); ok {
+			if err := s.value.Set(v); err != nil {
+				return nil, fmt.Errorf("config: %s: %w", s.env, err)
+			}
+		}
+	}
+
+	set := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	flagValues := fromFlags.settings()
+	for i, s := range config.settings() {
+		if set[s.name] {
+			s.value.Set(flagValues[i].value.String())
+		}
+	}
+
+	config.Args = flags.Args()
+	return config, config.Validate()
+}
+
+func (config *Config) readFile(path string) error {
+	file, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(file, config)
+	if err != nil {
+		return fmt.Errorf("parsing config %s: %w", path, err)
+	}
+	return nil
+}
+
+// Validate checks the config is usable and loads the time zone
+func (config *Config) Validate() error {
+	if config.Database == "" {
+		return errors.New("config: no database given")
+	}
+	if err := validCoordinate("latitude", config.Latitude, 90); err != nil {
+		return err
+	}
+	if err := validCoordinate("longitude", config.Longitude, 180); err != nil {
+		return err
+	}
+	if _, err := NewWeatherProvider(config.Weather); err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	loc, err := time.LoadLocation(config.TimeZone)
+	if err != nil {
+		return fmt.Errorf("config: time zone: %w", err)
+	}
+	config.Location = loc
+	if config.FullImage == "" || config.OutputImage == "" {
+		return errors.New("config: output image paths cannot be empty")
+	}
+	if config.FullRefreshEvery < 0 {
+		return errors.New("config: full refresh count cannot be negative")
+	}
+	if config.PartialMaxArea < 0 || config.PartialMaxArea > 1 {
+		return errors.New("config: partial refresh area must be between 0 and 1")
+	}
+	if config.PriceDataset != "DayAheadPrices" && config.PriceDataset != "Elspotprices" {
+		return fmt.Errorf("config: unknown price dataset %q", config.PriceDataset)
+	}
+	config.PriceStep, err = time.ParseDuration(config.PriceResolution)
+	if err != nil {
+		return fmt.Errorf("config: price resolution: %w", err)
+	}
+	// day-ahead prices are in 15 minute steps, and intervals have to add up
+	// to whole hours
+	if config.PriceStep <= 0 || config.PriceStep%(15*time.Minute) != 0 || time.Hour%config.PriceStep != 0 {
+		return fmt.Errorf("config: price resolution %s must be 15m, 30m or 1h", config.PriceResolution)
+	}
+	if config.Budget < 0 {
+		return errors.New("config: budget cannot be negative")
+	}
+	meters := map[string]bool{MainMeter: true, RemainderMeter: true}
+	for _, m := range config.SubMeters {
+		if m.Name == "" {
+			return errors.New("config: sub-meters need a name")
+		}
+		if meters[m.Name] {
+			return fmt.Errorf("config: sub-meter name %q is taken", m.Name)
+		}
+		meters[m.Name] = true
+	}
+	if config.PriceVAT < 0 {
+		return errors.New("config: VAT cannot be negative")
+	}
+	for i := range config.Tariffs {
+		if err := config.Tariffs[i].load(config.Location); err != nil {
+			return fmt.Errorf("config: %w", err)
+		}
+	}
+	for i := range config.ExportTariffs {
+		if err := config.ExportTariffs[i].load(config.Location); err != nil {
+			return fmt.Errorf("config: export %w", err)
+		}
+	}
+	config.Thresholds = nil
+	if config.PriceThresholds != "" {
+		for _, field := range strings.Split(config.PriceThresholds, ",") {
+			limit, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+			if err != nil {
+				return fmt.Errorf("config: price thresholds: %w", err)
+			}
+			if n := len(config.Thresholds); n > 0 && limit < config.Thresholds[n-1] {
+				return errors.New("config: price thresholds must go up")
+			}
+			config.Thresholds = append(config.Thresholds, limit)
+		}
+		if len(config.Thresholds) != len(PriceLevels{}) {
+			return fmt.Errorf("config: need %d price thresholds", len(PriceLevels{}))
+		}
+	}
+	if _, err := NewNotifiers(config); err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	if config.NotifyService != "" && config.NotifyURL == "" {
+		return errors.New("config: no notification URL given")
+	}
+	if config.SMTPServer != "" && (config.MailFrom == "" || config.MailTo == "") {
+		return errors.New("config: mailing notifications needs from and to addresses")
+	}
+	config.AlertLength = 0
+	if config.AlertWindow != "" {
+		config.AlertLength, err = time.ParseDuration(config.AlertWindow)
+		if err != nil {
+			return fmt.Errorf("config: alert window: %w", err)
+		}
+		if config.AlertLength <= 0 || config.AlertLength > 24*time.Hour {
+			return errors.New("config: alert window must be up to a day")
+		}
+	}
+	config.HANCipherKey, err = parseKey("HAN key", config.HANKey)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	config.HANAuthenticationKey, err = parseKey("HAN authentication key", config.HANAuthKey)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	if config.HANEnergyUnit <= 0 {
+		return errors.New("config: HAN energy unit must be positive")
+	}
+	config.WeatherEvery, err = time.ParseDuration(config.WeatherInterval)
+	if err != nil {
+		return fmt.Errorf("config: weather interval: %w", err)
+	}
+	if config.WeatherEvery < time.Minute {
+		return errors.New("config: weather interval must be at least a minute")
+	}
+	if config.UsageHour < 0 || config.UsageHour > 23 {
+		return errors.New("config: usage hour must be between 0 and 23")
+	}
+	return nil
+}
+
+// ValidateRender checks the files the display is drawn with are there, the
+// commands that only fetch or import data do without them
+func (config *Config) ValidateRender() error {
+	for _, path := range []string{config.Font, config.Layout} {
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("config: %w", err)
+		}
+	}
+	return nil
+}
+
+// Notifying is whether notifications are set up
+func (config *Config) Notifying() bool {
+	return config.NotifyService != "" || config.SMTPServer != ""
+}
+
+// AlertRules are what tomorrow's prices are notified of
+func (config *Config) AlertRules() AlertRules {
+	return AlertRules{
+		Above:    config.AlertAbove,
+		Negative: config.AlertNegative,
+		Window:   config.AlertLength,
+	}
+}
+
+// RefreshPolicy is the policy for partial refreshes of the panel
+func (config *Config) RefreshPolicy() RefreshPolicy {
+	return RefreshPolicy{
+		FullEvery: config.FullRefreshEvery,
+		MaxArea:   config.PartialMaxArea,
+	}
+}
+
+// PriceModel is how the consumer price is worked out from the spot price
+func (config *Config) PriceModel() *PriceModel {
+	model := &PriceModel{VAT: config.PriceVAT}
+	if config.PriceTariff != 0 {
+		model.Tariffs = append(model.Tariffs, Tariff{Name: "tariff", Price: config.PriceTariff})
+	}
+	if config.PriceTransmission != 0 {
+		model.Tariffs = append(model.Tariffs, Tariff{Name: "transmission", Price: config.PriceTransmission})
+	}
+	model.Tariffs = append(model.Tariffs, config.Tariffs...)
+	if config.ExportFee != 0 {
+		model.ExportTariffs = append(model.ExportTariffs, Tariff{Name: "export fee", Price: config.ExportFee})
+	}
+	model.ExportTariffs = append(model.ExportTariffs, config.ExportTariffs...)
+	return model
+}
+
+func validCoordinate(name, value string, limit float64) error {
+	if value == "" {
+		return fmt.Errorf("config: no %s given", name)
+	}
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return fmt.Errorf("config: %s: %w", name, err)
+	}
+	if v < -limit || v > limit {
+		return fmt.Errorf("config: %s %s out of range", name, value)
+	}
+	return nil
+}
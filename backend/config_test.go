@@ -0,0 +1,170 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// clearEnv unsets the settings' environment variables for the test, putting
+// them back after it
+func clearEnv(t *testing.T) {
+	t.Helper()
+	names := []string{"DISPLAY_CONFIG"}
+	for _, s := range defaultConfig().settings() {
+		names = append(names, s.env)
+	}
+	for _, name := range names {
+		name := name
+		if v, ok := os.LookupEnv(name); ok {
+			t.Cleanup(func() { os.Setenv(name, v) })
+		} else {
+			t.Cleanup(func() { os.Unsetenv(name) })
+		}
+		os.Unsetenv(name)
+	}
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	err := ioutil.WriteFile(path, []byte(`{"Database": "file.db", "Latitude": "56.1"}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		env      map[string]string
+		args     []string
+		database string
+		latitude string
+	}{
+		{"defaults", nil, nil, "electricity.db", "55.7034"},
+		{"file", nil, []string{"-config", path}, "file.db", "56.1"},
+		{"file from the environment", map[string]string{"DISPLAY_CONFIG": path}, nil, "file.db", "56.1"},
+		{"environment over file", map[string]string{"DISPLAY_DATABASE": "env.db"}, []string{"-config", path}, "env.db", "56.1"},
+		{"environment over defaults", map[string]string{"DISPLAY_LATITUDE": "57"}, nil, "electricity.db", "57"},
+		{"flag over environment", map[string]string{"DISPLAY_DATABASE": "env.db"}, []string{"-config", path, "-db", "flag.db"}, "flag.db", "56.1"},
+		// a flag given with the default value still wins
+		{"default flag over environment", map[string]string{"DISPLAY_LATITUDE": "57"}, []string{"-lat", "55.7034"}, "electricity.db", "55.7034"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clearEnv(t)
+			for name, v := range test.env {
+				os.Setenv(name, v)
+			}
+			config, err := LoadConfig(test.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if config.Database != test.database || config.Latitude != test.latitude {
+				t.Errorf("got database %s and latitude %s, want %s and %s", config.Database, config.Latitude, test.database, test.latitude)
+			}
+		})
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	clearEnv(t)
+	dir := t.TempDir()
+	bad := filepath.Join(dir, "bad.json")
+	if err := ioutil.WriteFile(bad, []byte(`{"Database": `), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{
+		{"-config", filepath.Join(dir, "missing.json")},
+		{"-config", bad},
+		{"-no-such-flag"},
+		{"-lat", "north"},
+		{"-full-every", "often"},
+	} {
+		if _, err := LoadConfig(args); err == nil {
+			t.Errorf("no error loading %v", args)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := defaultConfig().Validate(); err != nil {
+		t.Fatalf("the defaults are not valid: %v", err)
+	}
+	tests := []struct {
+		name   string
+		change func(c *Config)
+		err    string
+	}{
+		{"no database", func(c *Config) { c.Database = "" }, "no database"},
+		{"no latitude", func(c *Config) { c.Latitude = "" }, "no latitude"},
+		{"latitude", func(c *Config) { c.Latitude = "north" }, "latitude"},
+		{"latitude out of range", func(c *Config) { c.Latitude = "91" }, "out of range"},
+		{"longitude out of range", func(c *Config) { c.Longitude = "-180.5" }, "out of range"},
+		{"time zone", func(c *Config) { c.TimeZone = "Europe/Atlantis" }, "time zone"},
+		{"no output image", func(c *Config) { c.OutputImage = "" }, "output image"},
+		{"weather provider", func(c *Config) { c.Weather = "yr" }, "unknown weather provider"},
+		{"full refresh count", func(c *Config) { c.FullRefreshEvery = -1 }, "full refresh"},
+		{"partial refresh area", func(c *Config) { c.PartialMaxArea = 1.5 }, "partial refresh area"},
+		{"weather interval", func(c *Config) { c.WeatherInterval = "half an hour" }, "weather interval"},
+		{"short weather interval", func(c *Config) { c.WeatherInterval = "10s" }, "at least a minute"},
+		{"usage hour", func(c *Config) { c.UsageHour = 24 }, "usage hour"},
+		{"price dataset", func(c *Config) { c.PriceDataset = "Spot" }, "unknown price dataset"},
+		{"negative VAT", func(c *Config) { c.PriceVAT = -25 }, "VAT"},
+		{"price resolution", func(c *Config) { c.PriceResolution = "quarter" }, "price resolution"},
+		{"uneven price resolution", func(c *Config) { c.PriceResolution = "20m" }, "must be 15m, 30m or 1h"},
+		{"tariff month", func(c *Config) { c.Tariffs = []Tariff{{Name: "winter", Months: []int{13}}} }, "no month 13"},
+		{"tariff hours", func(c *Config) { c.Tariffs = []Tariff{{Name: "peak", Hours: []float64{1, 2}}} }, "24 hourly amounts"},
+		{"tariff dates", func(c *Config) { c.Tariffs = []Tariff{{Name: "old", From: "2026-04-01", To: "2026-01-01"}} }, "ends before it starts"},
+		{"price thresholds", func(c *Config) { c.PriceThresholds = "50,cheap,150,200" }, "price thresholds"},
+		{"falling price thresholds", func(c *Config) { c.PriceThresholds = "200,150,100,50" }, "must go up"},
+		{"too few price thresholds", func(c *Config) { c.PriceThresholds = "50,100" }, "need 4 price thresholds"},
+		{"HAN key", func(c *Config) { c.HANKey = "00112233" }, "HAN key must be 16 bytes"},
+		{"HAN authentication key", func(c *Config) { c.HANAuthKey = "not hex" }, "invalid byte"},
+		{"HAN energy unit", func(c *Config) { c.HANEnergyUnit = 0 }, "energy unit"},
+		{"export tariff", func(c *Config) { c.ExportTariffs = []Tariff{{Name: "feed-in", Months: []int{0}}} }, "export tariff feed-in"},
+		{"notification service", func(c *Config) { c.NotifyService = "pushover" }, "unknown notification service"},
+		{"no notification URL", func(c *Config) { c.NotifyService = "ntfy" }, "notification URL"},
+		{"no mail addresses", func(c *Config) { c.SMTPServer = "localhost:25" }, "from and to addresses"},
+		{"alert window", func(c *Config) { c.AlertWindow = "3 hours" }, "alert window"},
+		{"long alert window", func(c *Config) { c.AlertWindow = "25h" }, "up to a day"},
+		{"negative budget", func(c *Config) { c.Budget = -100 }, "budget"},
+		{"unnamed sub-meter", func(c *Config) { c.SubMeters = []SubMeter{{MeteringPoint: "571313100000000002"}} }, "need a name"},
+		{"sub-meter named main", func(c *Config) { c.SubMeters = []SubMeter{{Name: MainMeter}} }, "is taken"},
+		{"sub-meter named twice", func(c *Config) { c.SubMeters = []SubMeter{{Name: "heat pump"}, {Name: "heat pump"}} }, "is taken"},
+	}
+	for _, test := range tests {
+		config := defaultConfig()
+		test.change(config)
+		if err := config.Validate(); err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: got %v, want an error about %s", test.name, err, test.err)
+		}
+	}
+}
+
+func TestValidateRender(t *testing.T) {
+	dir := t.TempDir()
+	font := filepath.Join(dir, "font.ttf")
+	layout := filepath.Join(dir, "layout.json")
+	for _, path := range []string{font, layout} {
+		if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	config := defaultConfig()
+	config.Font, config.Layout = font, layout
+	if err := config.ValidateRender(); err != nil {
+		t.Error(err)
+	}
+	config.Font = filepath.Join(dir, "missing.ttf")
+	if err := config.ValidateRender(); err == nil {
+		t.Error("no error for a missing font")
+	}
+	config.Font, config.Layout = font, filepath.Join(dir, "missing.json")
+	if err := config.ValidateRender(); err == nil {
+		t.Error("no error for a missing layout")
+	}
+	// fetching and importing do without them
+	if err := config.Validate(); err != nil {
+		t.Error(err)
+	}
+}
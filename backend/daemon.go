@@ -0,0 +1,100 @@
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// RunDaemon keeps the dashboard up to date until it gets SIGTERM or SIGINT.
+// On SIGHUP reload is called for a new config and the dashboard rebuilt,
+// from the old config again if the new one cannot be used
+func RunDaemon(dashboard *Dashboard, reload func() (*Config, error)) error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	next := make(map[string]time.Time)
+	now := time.Now()
+	for _, source := range Sources {
+		next[source] = now
+	}
+
+	for {
+		wake := next[Sources[0]]
+		for _, t := range next {
+			if t.Before(wake) {
+				wake = t
+			}
+		}
+		timer := time.NewTimer(time.Until(wake))
+
+		select {
+		case <-timer.C:
+			now := time.Now()
+			var due []string
+			for _, source := range Sources {
+				if !now.Before(next[source]) {
+					due = append(due, source)
+					next[source] = dashboard.nextRun(source, now)
+				}
+			}
+			if err := dashboard.Update(due...); err != nil {
+				log.Println(err)
+			}
+
+		case sig := <-signals:
+			timer.Stop()
+			if sig != syscall.SIGHUP {
+				log.Println("received", sig, "shutting down")
+				return dashboard.Close()
+			}
+			log.Println("reloading config")
+			config, err := reload()
+			if err != nil {
+				log.Println("keeping old config:", err)
+				continue
+			}
+			// the panel and database can only be open once
+			previous := dashboard.config
+			dashboard.Close()
+			rebuilt, err := NewDashboard(config)
+			if err != nil {
+				log.Println("keeping old config:", err)
+				rebuilt, err = NewDashboard(previous)
+				if err != nil {
+					return err
+				}
+			}
+			dashboard = rebuilt
+			now := time.Now()
+			for _, source := range Sources {
+				next[source] = now
+			}
+		}
+	}
+}
+
+// nextRun is when a source should next be reloaded. The clock updates every
+// minute, prices at the start of each price interval, usage once a day and
+// the weather at the configured interval
+func (d *Dashboard) nextRun(source string, now time.Time) time.Time {
+	now = now.In(d.config.Location)
+	switch source {
+	case WeatherSource:
+		return now.Add(d.config.WeatherEvery)
+	case PriceSource:
+		// the intervals divide an hour, so they start at the same times
+		// whatever the time zone
+		return now.Truncate(d.config.PriceStep).Add(d.config.PriceStep)
+	case UsageSource:
+		t := time.Date(now.Year(), now.Month(), now.Day(), d.config.UsageHour, 0, 0, 0, now.Location())
+		if !t.After(now) {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t
+	}
+	return now.Truncate(time.Minute).Add(time.Minute)
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextRun(t *testing.T) {
+	loc := copenhagen(t)
+	at := func(hour, min, sec int) time.Time {
+		return time.Date(2026, 1, 18, hour, min, sec, 0, loc)
+	}
+	tests := []struct {
+		source string
+		step   time.Duration
+		now    time.Time
+		want   time.Time
+	}{
+		{PriceSource, 15 * time.Minute, at(10, 7, 30), at(10, 15, 0)},
+		{PriceSource, 15 * time.Minute, at(10, 45, 0), at(11, 0, 0)},
+		{PriceSource, 30 * time.Minute, at(10, 15, 0), at(10, 30, 0)},
+		{PriceSource, time.Hour, at(10, 59, 59), at(11, 0, 0)},
+		{PriceSource, time.Hour, at(23, 30, 0), at(24, 0, 0)},
+		{ClockSource, time.Hour, at(10, 7, 30), at(10, 8, 0)},
+		{UsageSource, time.Hour, at(10, 7, 30), at(24+6, 0, 0)},
+		{UsageSource, time.Hour, at(5, 0, 0), at(6, 0, 0)},
+		{WeatherSource, time.Hour, at(10, 7, 30), at(10, 37, 30)},
+	}
+	for _, test := range tests {
+		d := &Dashboard{config: &Config{
+			Location:     loc,
+			PriceStep:    test.step,
+			UsageHour:    6,
+			WeatherEvery: 30 * time.Minute,
+		}}
+		if got := d.nextRun(test.source, test.now); !got.Equal(test.want) {
+			t.Errorf("%s at %s with %s steps runs at %s, want %s", test.source, test.now.Format("15:04:05"), test.step, got, test.want)
+		}
+	}
+}
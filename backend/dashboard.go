@@ -0,0 +1,226 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"agurk.org/display/backend/epd"
+	"golang.org/x/image/bmp"
+)
+
+// Dashboard holds everything needed to draw the display and send it out,
+// so that it can be kept around between updates
+type Dashboard struct {
+	config   *Config
+	layout   *Layout
+	renderer *Renderer
+	panel    *epd.Display
+	meter    *Meter
+}
+
+func NewDashboard(config *Config) (*Dashboard, error) {
+	if err := config.ValidateRender(); err != nil {
+		return nil, err
+	}
+	d := new(Dashboard)
+	d.config = config
+	var err error
+	var subMeters []string
+	for _, m := range config.SubMeters {
+		subMeters = append(subMeters, m.Name)
+	}
+	d.layout, err = LoadLayout(config.Layout, subMeters)
+	if err != nil {
+		return nil, err
+	}
+	provider, err := NewWeatherProvider(config.Weather)
+	if err != nil {
+		return nil, err
+	}
+	screen := NewScreen(d.layout.Width, d.layout.Height)
+	err = screen.LoadFont(config.Font)
+	if err != nil {
+		return nil, err
+	}
+	power, err := NewPower(config.Database, config.Location)
+	if err != nil {
+		return nil, err
+	}
+	power.Model = config.PriceModel()
+	power.Thresholds = config.Thresholds
+	power.SubMeters = subMeters
+	// the last one bit image is what is currently on the panel
+	previous, err := ioutil.ReadFile(config.OutputImage)
+	if err == nil {
+		screen.SetPrevious(previous, readPartials(config.RefreshState))
+	}
+	d.renderer = &Renderer{
+		Screen:    screen,
+		Power:     power,
+		Provider:  provider,
+		Latitude:  config.Latitude,
+		Longitude: config.Longitude,
+		Budget:    config.Budget,
+	}
+
+	if config.Panel != "" {
+		bus, err := epd.Open(config.Panel, config.GPIOChip, epd.HATPins)
+		if err != nil {
+			d.Close()
+			return nil, err
+		}
+		d.panel = epd.New(bus)
+	}
+
+	// the meter is only read while the daemon keeps running
+	if config.Daemon && config.HANDevice != "" {
+		d.meter, err = OpenMeter(config, power)
+		if err != nil {
+			d.Close()
+			return nil, err
+		}
+		d.renderer.Meter = d.meter
+		go func(meter *Meter) {
+			if err := meter.Run(); err != nil && !errors.Is(err, os.ErrClosed) {
+				log.Println("reading meter stopped:", err)
+			}
+		}(d.meter)
+	}
+	return d, nil
+}
+
+// Update reloads the given sources and redraws the display, nothing is
+// written out if the image has not changed
+func (d *Dashboard) Update(sources ...string) error {
+	for _, source := range sources {
+		if source == PriceSource && d.config.PriceArea != "" {
+			if err := FetchPrices(d.config, d.renderer.Power); err != nil {
+				log.Println("fetching prices:", err)
+			}
+			if d.config.CO2 {
+				if err := FetchEmissions(d.config, d.renderer.Power); err != nil {
+					log.Println("fetching CO2 emissions:", err)
+				}
+			}
+			if d.config.Notifying() {
+				if err := SendAlerts(d.config, d.renderer.Power); err != nil {
+					log.Println("sending alerts:", err)
+				}
+			}
+		}
+		if source == UsageSource && d.config.EloverblikToken != "" {
+			if err := ImportUsage(d.config, d.renderer.Power); err != nil {
+				log.Println("importing usage:", err)
+			}
+		}
+		if source == UsageSource {
+			if err := d.renderer.Power.UpdateShifting(time.Now()); err != nil {
+				log.Println("updating shifting history:", err)
+			}
+		}
+		if err := d.renderer.Load(source); err != nil {
+			log.Println(err)
+		}
+	}
+	screen := d.renderer.Screen
+	screen.Clear()
+	d.renderer.Render(d.layout)
+	refresh := screen.Refresh(d.config.RefreshPolicy())
+	if len(refresh.Windows) == 0 {
+		return nil
+	}
+
+	err := d.writeImages(refresh)
+	if err != nil {
+		return err
+	}
+	if d.panel != nil {
+		return d.show(refresh)
+	}
+	return nil
+}
+
+func (d *Dashboard) writeImages(refresh *Refresh) error {
+	bmp8, err := os.Create(d.config.FullImage)
+	if err != nil {
+		return err
+	}
+	defer bmp8.Close()
+	err = bmp.Encode(bmp8, d.renderer.Screen.Image)
+	if err != nil {
+		return err
+	}
+
+	oneBmp, err := os.Create(d.config.OutputImage)
+	if err != nil {
+		return err
+	}
+	defer oneBmp.Close()
+	_, err = oneBmp.Write(refresh.Image)
+	if err != nil {
+		return err
+	}
+	err = oneBmp.Sync()
+	if err != nil {
+		return err
+	}
+	partials := strconv.Itoa(d.renderer.Screen.Partials)
+	return ioutil.WriteFile(d.config.RefreshState, []byte(partials), 0644)
+}
+
+// show sends the changed parts of the image to the panel
+func (d *Dashboard) show(refresh *Refresh) error {
+	err := d.panel.Init()
+	if err != nil {
+		return err
+	}
+	if refresh.Full {
+		err = d.panel.Display(refresh.Image)
+		if err != nil {
+			return err
+		}
+	} else {
+		for _, window := range refresh.Windows {
+			err = d.panel.DisplayPartial(refresh.Previous, refresh.Image, window)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return d.panel.DeepSleep()
+}
+
+func (d *Dashboard) Close() error {
+	var err error
+	if d.panel != nil {
+		err = d.panel.Close()
+	}
+	if d.meter != nil {
+		if meterErr := d.meter.Close(); err == nil {
+			err = meterErr
+		}
+	}
+	if dbErr := d.renderer.Power.Db.Close(); err == nil {
+		err = dbErr
+	}
+	return err
+}
+
+// readPartials returns the number of partial refreshes done since the last
+// full one, as saved by the previous run
+func readPartials(path string) int {
+	state, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	partials, err := strconv.Atoi(strings.TrimSpace(string(state)))
+	if err != nil {
+		return 0
+	}
+	return partials
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const dmiURL = "https://www.dmi.dk/NinJo2DmiDk/ninjo2dmidk"
+
+// DMI gets forecasts from the Danish Meteorological Institute's NinJo service
+type DMI struct {
+	BaseURL string
+	Client  *http.Client
+}
+
+// Begin DMI Data Struct
+type data struct {
+	Id         string
+	City       string
+	Country    string
+	Longitude  float64
+	Latitude   float64
+	Timezone   string
+	Lastupdate string
+	Sunrise    string
+	Sunset     string
+	Timeserie  []timeserie
+	AggData    []aggdata
+}
+
+type timeserie struct {
+	Time        string
+	Temp        float64
+	Symbol      int
+	Precip1     float64
+	PrecipType  string
+	WindDir     string
+	WindDegree  float64
+	WindSpeed   float64
+	WindGust    float64
+	Humidity    float64
+	Pressure    float64
+	Visibility  float64
+	Precip3     float64
+	Precip6     float64
+	Temp10      float64
+	Temp50      float64
+	Temp90      float64
+	Prec10      float64
+	Prec50      float64
+	Prec75      float64
+	Prec90      float64
+	Windspeed10 float64
+	Windspeed50 float64
+	Windspeed90 float64
+}
+
+type aggdata struct {
+	Time        string
+	MinTemp     float64
+	MeanTemp    float64
+	MaxTemp     float64
+	PrecipSum   float64
+	UvRadiation float64
+}
+
+// End DMI Data Struct
+
+func (d *DMI) Fetch(latitude, longitude string) (*WeatherReport, error) {
+	resp, err := d.Client.Get(d.url(latitude, longitude))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("dmi: %s", resp.Status)
+	}
+	var weather data
+	err = json.NewDecoder(resp.Body).Decode(&weather)
+	if err != nil {
+		return nil, fmt.Errorf("dmi: %w", err)
+	}
+	return weather.report()
+}
+
+func (d *DMI) url(latitude, longitude string) string {
+	return d.BaseURL + "?cmd=llj&lon=" + longitude + "&lat=" + latitude
+}
+
+func (weather *data) report() (*WeatherReport, error) {
+	loc, err := time.LoadLocation(weather.Timezone)
+	if err != nil {
+		loc = time.Local
+	}
+	report := new(WeatherReport)
+	for _, t := range weather.Timeserie {
+		o, err := t.observation(loc)
+		if err != nil {
+			return nil, err
+		}
+		report.Hours = append(report.Hours, o)
+	}
+	for _, a := range weather.AggData {
+		date, err := time.ParseInLocation("20060102", a.Time, loc)
+		if err != nil {
+			return nil, fmt.Errorf("dmi: %w", err)
+		}
+		report.Days = append(report.Days, DaySummary{
+			Date:          date,
+			MinTemp:       a.MinTemp,
+			MaxTemp:       a.MaxTemp,
+			Precipitation: a.PrecipSum,
+			UV:            a.UvRadiation,
+		})
+	}
+	if len(report.Hours) > 0 {
+		report.Current = report.Hours[0]
+	}
+	today := time.Now().In(loc)
+	if report.Sunrise, err = dmiClock(today, weather.Sunrise); err != nil {
+		return nil, err
+	}
+	if report.Sunset, err = dmiClock(today, weather.Sunset); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// dmiClock parses DMI's sunrise/sunset times, which are given as H:MM or
+// HH:MM without the colon
+func dmiClock(day time.Time, clock string) (time.Time, error) {
+	if len(clock) < 3 {
+		return time.Time{}, fmt.Errorf("dmi: bad time %q", clock)
+	}
+	hour, err := strconv.Atoi(clock[:len(clock)-2])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("dmi: %w", err)
+	}
+	minute, err := strconv.Atoi(clock[len(clock)-2:])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("dmi: %w", err)
+	}
+	return time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, day.Location()), nil
+}
+
+func (t *timeserie) observation(loc *time.Location) (Observation, error) {
+	at, err := time.ParseInLocation("20060102150405", t.Time, loc)
+	if err != nil {
+		return Observation{}, fmt.Errorf("dmi: %w", err)
+	}
+	o := Observation{
+		Time:                at,
+		Description:         dmiDescription(t.Symbol),
+		Temp:                t.Temp,
+		PrecipitationAmount: t.Precip1,
+		PrecipitationType:   t.PrecipType,
+		WindSpeed:           t.WindSpeed,
+		WindGust:            t.WindGust,
+		WindDirection:       t.WindDir,
+		Humidity:            t.Humidity,
+		Pressure:            t.Pressure,
+		Visibility:          t.Visibility,
+	}
+	switch t.Symbol {
+	case 1, 101:
+		o.Sky = Clear
+	case 2, 80, 81, 83, 84, 85, 86, 102, 180, 181, 183, 184, 185, 186:
+		o.Sky = Broken
+	case 3, 60, 63, 68, 69, 70, 73, 103, 160, 163, 168, 169, 170, 173:
+		o.Sky = Cloudy
+	case 45, 145:
+		o.Sky = Fog
+	default:
+		fmt.Println("Unknown symbol: ", t.Symbol, "at", t.Time)
+	}
+	switch t.Symbol {
+	case 60, 80, 160, 180:
+		o.Precipitation = LightRain
+	case 63, 81, 163, 181:
+		o.Precipitation = HeavyRain
+	case 68, 83, 168, 183:
+		o.Precipitation = LightSleet
+	case 69, 84, 169, 184:
+		o.Precipitation = HeavySleet
+	case 70, 85, 170, 185:
+		o.Precipitation = LightSnow
+	case 73, 86, 173, 186:
+		o.Precipitation = HeavySnow
+	}
+	return o, nil
+}
+
+func dmiDescription(symbol int) string {
+	switch symbol {
+	case 1:
+		return "Sunny"
+	case 2, 102:
+		return "Broken Clouds"
+	case 3, 103:
+		return "Cloudy"
+	case 45, 145:
+		return "Fog"
+	case 60, 80, 160, 180:
+		return "Light Rain"
+	case 63, 81, 163, 181:
+		return "Heavy Rain"
+	case 68, 83, 168, 183:
+		return "Light Sleet"
+	case 69, 84, 169, 184:
+		return "Heavy Sleet"
+	case 70, 85, 170, 185:
+		return "Light Snow"
+	case 73, 86, 173, 186:
+		return "Heavy Snow"
+	case 101:
+		return "Clear"
+	default:
+		return "Undefined " + strconv.Itoa(symbol)
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Energinet's CO2 datasets, both in 5 minute steps. The prognosis covers
+// the rest of today and tomorrow, the realtime figures replace it as they
+// come in
+const (
+	emissionDataset          = "CO2Emis"
+	emissionPrognosisDataset = "CO2EmisProg"
+)
+
+// Emission is the CO2 emitted producing electricity over a period, in g/kWh
+type Emission struct {
+	Start     time.Time
+	End       time.Time
+	Intensity float64
+}
+
+// EmissionFetcher gets the CO2 emission intensity from Energi Data Service
+type EmissionFetcher struct {
+	BaseURL string
+	Client  *http.Client
+	// Area is the bidding area, e.g. DK1 or DK2
+	Area string
+	// Resolution is the length of the stored intervals, the figures are
+	// averaged up to it like prices
+	Resolution time.Duration
+}
+
+func NewEmissionFetcher(config *Config) *EmissionFetcher {
+	return &EmissionFetcher{
+		BaseURL:    energiDataServiceURL,
+		Client:     http.DefaultClient,
+		Area:       config.PriceArea,
+		Resolution: config.PriceStep,
+	}
+}
+
+// Fetch returns the emissions in a dataset between start and end
+func (f *EmissionFetcher) Fetch(dataset string, start, end time.Time) ([]Emission, error) {
+	resp, err := f.Client.Get(datasetURL(f.BaseURL, dataset, "Minutes5UTC", f.Area, start, end))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("energi data service %s: %s", dataset, resp.Status)
+	}
+	var data energiDataServiceData
+	err = json.NewDecoder(resp.Body).Decode(&data)
+	if err != nil {
+		return nil, fmt.Errorf("energi data service %s: %w", dataset, err)
+	}
+
+	// the figures are averaged up the same way as prices
+	var intervals []PriceInterval
+	for _, r := range data.Records {
+		if r.CO2Emission == nil {
+			continue
+		}
+		t, err := time.Parse("2006-01-02T15:04:05", r.Minutes5UTC)
+		if err != nil {
+			return nil, fmt.Errorf("energi data service %s: %w", dataset, err)
+		}
+		intervals = append(intervals, PriceInterval{Start: t, End: t.Add(5 * time.Minute), Price: *r.CO2Emission})
+	}
+	var emissions []Emission
+	for _, p := range aggregatePrices(intervals, f.Resolution) {
+		emissions = append(emissions, Emission{Start: p.Start, End: p.End, Intensity: p.Price})
+	}
+	return emissions, nil
+}
+
+// FetchEmissions stores the CO2 emission intensity for the configured area
+// over the same days as FetchPrices, measured where it is known and the
+// prognosis after that
+func FetchEmissions(config *Config, power *Power) error {
+	if config.PriceArea == "" {
+		return errors.New("no price area configured")
+	}
+	now := time.Now().In(config.Location)
+	start := time.Date(now.Year(), now.Month(), now.Day()-1, 0, 0, 0, 0, config.Location)
+	end := time.Date(now.Year(), now.Month(), now.Day()+2, 0, 0, 0, 0, config.Location)
+	fetcher := NewEmissionFetcher(config)
+	prognosis, err := fetcher.Fetch(emissionPrognosisDataset, start, end)
+	if err != nil {
+		return err
+	}
+	if err = power.StoreEmissions(prognosis, true); err != nil {
+		return err
+	}
+	measured, err := fetcher.Fetch(emissionDataset, start, now)
+	if err != nil {
+		return err
+	}
+	return power.StoreEmissions(measured, false)
+}
+
+// StoreEmissions writes emissions into the emissions table, replacing any
+// already there for the same start. A prognosis never replaces a measured
+// figure
+func (power *Power) StoreEmissions(emissions []Emission, prognosis bool) error {
+	tx, err := power.Db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, e := range emissions {
+		start := e.Start.UTC().Format(usageFormat)
+		if prognosis {
+			_, err = tx.Exec("delete from emissions where start = $1 and prognosis = 1", start)
+		} else {
+			_, err = tx.Exec("delete from emissions where start = $1", start)
+		}
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		_, err = tx.Exec(`insert into emissions (intensity, start, end, prognosis)
+			select $1, $2, $3, $4 where not exists (select 1 from emissions where start = $2)`,
+			strconv.FormatFloat(e.Intensity, 'f', -1, 64), start, e.End.UTC().Format(usageFormat), prognosis)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// EmissionsBetween returns the emission intensity of the intervals
+// overlapping start until end, in order
+func (power *Power) EmissionsBetween(start, end time.Time) ([]Emission, error) {
+	query := "select intensity, start, end from emissions where start < $1 and end > $2 order by start"
+	rows, err := power.Db.Query(query, end.UTC().Format(usageFormat), start.UTC().Format(usageFormat))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var emissions []Emission
+	for rows.Next() {
+		var intensity, from, to string
+		err = rows.Scan(&intensity, &from, &to)
+		if err != nil {
+			return nil, err
+		}
+		var e Emission
+		e.Intensity, err = strconv.ParseFloat(intensity, 64)
+		if err != nil {
+			return nil, fmt.Errorf("emission from %s: %w", from, err)
+		}
+		e.Start, err = time.Parse(usageFormat, from)
+		if err != nil {
+			return nil, err
+		}
+		e.End, err = time.Parse(usageFormat, to)
+		if err != nil {
+			return nil, err
+		}
+		emissions = append(emissions, e)
+	}
+	return emissions, rows.Err()
+}
+
+// averageIntensity is the time weighted emission intensity over start until
+// end, false when none of it is known
+func averageIntensity(emissions []Emission, start, end time.Time) (float64, bool) {
+	var covered time.Duration
+	sum := 0.0
+	for _, e := range emissions {
+		from, to := e.Start, e.End
+		if from.Before(start) {
+			from = start
+		}
+		if to.After(end) {
+			to = end
+		}
+		if !to.After(from) {
+			continue
+		}
+		covered += to.Sub(from)
+		sum += e.Intensity * float64(to.Sub(from))
+	}
+	if covered == 0 {
+		return 0, false
+	}
+	return sum / float64(covered), true
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// emissionServer serves the recorded realtime and prognosis datasets
+func emissionServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	files := map[string]string{
+		"/dataset/" + emissionDataset:          "testdata/co2emis.json",
+		"/dataset/" + emissionPrognosisDataset: "testdata/co2emisprog.json",
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if r.URL.Query().Get("sort") != "Minutes5UTC asc" || r.URL.Query().Get("filter") != `{"PriceArea":["DK1"]}` {
+			http.Error(w, "bad query "+r.URL.RawQuery, http.StatusBadRequest)
+			return
+		}
+		body, err := ioutil.ReadFile(name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// checkEmissions compares emissions with want, given as their start in UTC
+// and intensity
+func checkEmissions(t *testing.T, got []Emission, want map[string]float64) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d intervals %v, want %d", len(got), got, len(want))
+	}
+	for _, e := range got {
+		start := e.Start.UTC().Format("15:04")
+		intensity, ok := want[start]
+		if !ok {
+			t.Errorf("unexpected interval from %s", start)
+			continue
+		}
+		if !near(e.Intensity, intensity) {
+			t.Errorf("intensity from %s is %v, want %v", start, e.Intensity, intensity)
+		}
+		if e.End.Sub(e.Start) != 15*time.Minute {
+			t.Errorf("interval from %s is %s long", start, e.End.Sub(e.Start))
+		}
+	}
+}
+
+func TestEmissionFetch(t *testing.T) {
+	server := emissionServer(t)
+	f := &EmissionFetcher{BaseURL: server.URL, Client: server.Client(), Area: "DK1", Resolution: 15 * time.Minute}
+	start := time.Date(2026, 1, 18, 0, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+
+	measured, err := f.Fetch(emissionDataset, start, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the last quarter is not complete yet
+	checkEmissions(t, measured, map[string]float64{"00:00": 126, "00:15": 144})
+
+	prognosis, err := f.Fetch(emissionPrognosisDataset, start, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEmissions(t, prognosis, map[string]float64{"00:00": 100, "00:15": 100, "00:30": 200, "00:45": 200})
+
+	if _, err = f.Fetch("CO2Missing", start, end); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("got %v, want a 404 error", err)
+	}
+}
+
+func TestEmissionFetchURL(t *testing.T) {
+	var requested string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = r.URL.String()
+		w.Write([]byte(`{"records": []}`))
+	}))
+	defer server.Close()
+	f := &EmissionFetcher{BaseURL: server.URL, Client: server.Client(), Area: "DK2", Resolution: time.Hour}
+	start := time.Date(2026, 7, 1, 0, 0, 0, 0, copenhagen(t))
+	emissions, err := f.Fetch(emissionPrognosisDataset, start, start.AddDate(0, 0, 1))
+	if err != nil || len(emissions) != 0 {
+		t.Fatalf("got %v, %v", emissions, err)
+	}
+	u, err := url.Parse(requested)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := u.Query()
+	// local midnight in summer is 22:00 UTC
+	if u.Path != "/dataset/CO2EmisProg" || query.Get("start") != "2026-06-30T22:00" || query.Get("end") != "2026-07-01T22:00" ||
+		query.Get("filter") != `{"PriceArea":["DK2"]}` {
+		t.Errorf("requested %s", requested)
+	}
+}
+
+func TestStoreEmissions(t *testing.T) {
+	server := emissionServer(t)
+	f := &EmissionFetcher{BaseURL: server.URL, Client: server.Client(), Area: "DK1", Resolution: 15 * time.Minute}
+	power := testPower(t, time.UTC)
+	start := time.Date(2026, 1, 18, 0, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+	prognosis, err := f.Fetch(emissionPrognosisDataset, start, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	measured, err := f.Fetch(emissionDataset, start, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the order FetchEmissions stores them in, then fetched again later
+	steps := []struct {
+		emissions []Emission
+		prognosis bool
+	}{
+		{prognosis, true},
+		{measured, false},
+		{prognosis, true},
+		{measured, false},
+	}
+	for _, step := range steps {
+		if err = power.StoreEmissions(step.emissions, step.prognosis); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stored, err := power.EmissionsBetween(start, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// measured figures replace the prognosis and are never replaced by it
+	checkEmissions(t, stored, map[string]float64{"00:00": 126, "00:15": 144, "00:30": 200, "00:45": 200})
+
+	// a later measurement replaces an earlier one
+	corrected := []Emission{{Start: start, End: start.Add(15 * time.Minute), Intensity: 130}}
+	if err = power.StoreEmissions(corrected, false); err != nil {
+		t.Fatal(err)
+	}
+	if err = power.StoreEmissions(prognosis, true); err != nil {
+		t.Fatal(err)
+	}
+	stored, err = power.EmissionsBetween(start, start.Add(15*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEmissions(t, stored, map[string]float64{"00:00": 130})
+}
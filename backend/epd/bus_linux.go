@@ -0,0 +1,167 @@
+package epd
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// ioctl requests, from linux/spi/spidev.h and linux/gpio.h
+const (
+	spiIocWrMode        = 0x40016b01
+	spiIocWrBitsPerWord = 0x40016b03
+	spiIocWrMaxSpeedHz  = 0x40046b04
+
+	gpioGetLineHandle       = 0xc16cb403
+	gpioGetLineValues       = 0xc040b408
+	gpioSetLineValues       = 0xc040b409
+	gpioHandleRequestInput  = 1 << 0
+	gpioHandleRequestOutput = 1 << 1
+	gpioHandlesMax          = 64
+)
+
+// spidev only accepts writes up to its bufsiz module parameter
+const spiChunk = 4096
+
+const spiSpeed = 4000000
+
+type gpioHandleRequest struct {
+	LineOffsets   [gpioHandlesMax]uint32
+	Flags         uint32
+	DefaultValues [gpioHandlesMax]uint8
+	ConsumerLabel [32]byte
+	Lines         uint32
+	Fd            int32
+}
+
+type gpioHandleData struct {
+	Values [gpioHandlesMax]uint8
+}
+
+// LinuxBus talks to the panel through spidev and the GPIO character device
+type LinuxBus struct {
+	spi   *os.File
+	reset *os.File
+	dc    *os.File
+	busy  *os.File
+}
+
+// Open sets up the SPI device (e.g. /dev/spidev0.0) and requests the pins
+// from the GPIO chip (e.g. /dev/gpiochip0)
+func Open(spiDevice, gpioChip string, pins Pins) (Bus, error) {
+	bus := new(LinuxBus)
+	var err error
+	bus.spi, err = os.OpenFile(spiDevice, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	mode, bits, speed := uint8(0), uint8(8), uint32(spiSpeed)
+	for _, setting := range []struct {
+		request uintptr
+		value   unsafe.Pointer
+	}{
+		{spiIocWrMode, unsafe.Pointer(&mode)},
+		{spiIocWrBitsPerWord, unsafe.Pointer(&bits)},
+		{spiIocWrMaxSpeedHz, unsafe.Pointer(&speed)},
+	} {
+		if err = ioctl(bus.spi.Fd(), setting.request, setting.value); err != nil {
+			bus.Close()
+			return nil, fmt.Errorf("epd: configuring %s: %w", spiDevice, err)
+		}
+	}
+
+	chip, err := os.OpenFile(gpioChip, os.O_RDWR, 0)
+	if err != nil {
+		bus.Close()
+		return nil, err
+	}
+	defer chip.Close()
+	lines := []struct {
+		file   **os.File
+		offset int
+		flags  uint32
+	}{
+		{&bus.reset, pins.Reset, gpioHandleRequestOutput},
+		{&bus.dc, pins.DC, gpioHandleRequestOutput},
+		{&bus.busy, pins.Busy, gpioHandleRequestInput},
+	}
+	for _, line := range lines {
+		*line.file, err = requestLine(chip, line.offset, line.flags)
+		if err != nil {
+			bus.Close()
+			return nil, fmt.Errorf("epd: requesting gpio %d: %w", line.offset, err)
+		}
+	}
+	return bus, nil
+}
+
+func requestLine(chip *os.File, offset int, flags uint32) (*os.File, error) {
+	var request gpioHandleRequest
+	request.LineOffsets[0] = uint32(offset)
+	request.Flags = flags
+	request.Lines = 1
+	copy(request.ConsumerLabel[:], "display")
+	err := ioctl(chip.Fd(), gpioGetLineHandle, unsafe.Pointer(&request))
+	if err != nil {
+		return nil, err
+	}
+	return os.NewFile(uintptr(request.Fd), fmt.Sprintf("gpio%d", offset)), nil
+}
+
+func ioctl(fd, request uintptr, arg unsafe.Pointer) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, request, uintptr(arg))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func setLine(line *os.File, high bool) error {
+	var data gpioHandleData
+	if high {
+		data.Values[0] = 1
+	}
+	return ioctl(line.Fd(), gpioSetLineValues, unsafe.Pointer(&data))
+}
+
+func (bus *LinuxBus) Write(data []byte) error {
+	for len(data) > 0 {
+		n := len(data)
+		if n > spiChunk {
+			n = spiChunk
+		}
+		if _, err := bus.spi.Write(data[:n]); err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+	return nil
+}
+
+func (bus *LinuxBus) SetDC(high bool) error {
+	return setLine(bus.dc, high)
+}
+
+func (bus *LinuxBus) SetReset(high bool) error {
+	return setLine(bus.reset, high)
+}
+
+func (bus *LinuxBus) Busy() (bool, error) {
+	var data gpioHandleData
+	err := ioctl(bus.busy.Fd(), gpioGetLineValues, unsafe.Pointer(&data))
+	return data.Values[0] == 0, err
+}
+
+func (bus *LinuxBus) Close() error {
+	var first error
+	for _, f := range []*os.File{bus.busy, bus.dc, bus.reset, bus.spi} {
+		if f == nil {
+			continue
+		}
+		if err := f.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package epd
+
+import "errors"
+
+// Open is only supported on Linux
+func Open(spiDevice, gpioChip string, pins Pins) (Bus, error) {
+	return nil, errors.New("epd: driving the panel directly needs Linux")
+}
@@ -0,0 +1,296 @@
+// Package epd drives the Waveshare 7.5" V2 (800x480) e-paper panel
+package epd
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"time"
+)
+
+const (
+	Width  = 800
+	Height = 480
+)
+
+var imageBounds = image.Rect(0, 0, Width, Height)
+
+// Controller commands
+const (
+	panelSetting     = 0x00
+	powerSetting     = 0x01
+	powerOff         = 0x02
+	powerOn          = 0x04
+	boosterSoftStart = 0x06
+	deepSleep        = 0x07
+	oldData          = 0x10
+	displayRefresh   = 0x12
+	newData          = 0x13
+	dualSPI          = 0x15
+	vcomInterval     = 0x50
+	tcon             = 0x60
+	resolution       = 0x61
+	getStatus        = 0x71
+	partialWindow    = 0x90
+	partialIn        = 0x91
+	partialOut       = 0x92
+)
+
+// BusyTimeout is how long to wait for the panel before giving up
+var BusyTimeout = 30 * time.Second
+
+// ErrBusyTimeout is returned when the panel stays busy for too long
+var ErrBusyTimeout = errors.New("epd: timed out waiting for panel")
+
+// Bus is the hardware the panel is connected through
+type Bus interface {
+	// Write sends bytes over SPI
+	Write(data []byte) error
+	// SetDC sets the data/command pin, high for data
+	SetDC(high bool) error
+	// SetReset sets the reset pin, the panel resets when it is low
+	SetReset(high bool) error
+	// Busy reports whether the panel is working, the V2 controller holds the
+	// busy pin low while it is
+	Busy() (bool, error)
+	Close() error
+}
+
+// Pins are the GPIO line offsets the panel is wired to
+type Pins struct {
+	Reset int
+	DC    int
+	Busy  int
+}
+
+// HATPins is the wiring of the Waveshare e-Paper HAT on a Raspberry Pi
+var HATPins = Pins{Reset: 17, DC: 25, Busy: 24}
+
+// Display is a Waveshare 7.5" V2 panel
+type Display struct {
+	bus Bus
+	// Sleep is used to wait between steps
+	Sleep func(time.Duration)
+}
+
+func New(bus Bus) *Display {
+	d := new(Display)
+	d.bus = bus
+	d.Sleep = time.Sleep
+	return d
+}
+
+func (d *Display) command(c byte, data ...byte) error {
+	if err := d.bus.SetDC(false); err != nil {
+		return err
+	}
+	if err := d.bus.Write([]byte{c}); err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	return d.data(data)
+}
+
+func (d *Display) data(data []byte) error {
+	if err := d.bus.SetDC(true); err != nil {
+		return err
+	}
+	return d.bus.Write(data)
+}
+
+// Reset pulses the reset pin
+func (d *Display) Reset() error {
+	for _, step := range []struct {
+		high bool
+		wait time.Duration
+	}{{true, 20 * time.Millisecond}, {false, 2 * time.Millisecond}, {true, 20 * time.Millisecond}} {
+		if err := d.bus.SetReset(step.high); err != nil {
+			return err
+		}
+		d.Sleep(step.wait)
+	}
+	return nil
+}
+
+// waitUntilIdle polls the controller status until the busy pin is released
+func (d *Display) waitUntilIdle() error {
+	start := time.Now()
+	for {
+		if err := d.command(getStatus); err != nil {
+			return err
+		}
+		busy, err := d.bus.Busy()
+		if err != nil {
+			return err
+		}
+		if !busy {
+			break
+		}
+		if time.Since(start) > BusyTimeout {
+			return ErrBusyTimeout
+		}
+		d.Sleep(20 * time.Millisecond)
+	}
+	d.Sleep(20 * time.Millisecond)
+	return nil
+}
+
+// Init wakes the panel and sets it up for a full refresh
+func (d *Display) Init() error {
+	if err := d.Reset(); err != nil {
+		return err
+	}
+	steps := []struct {
+		command byte
+		data    []byte
+	}{
+		{powerSetting, []byte{0x07, 0x07, 0x3f, 0x3f}},
+		{boosterSoftStart, []byte{0x17, 0x17, 0x28, 0x17}},
+		{powerOn, nil},
+	}
+	for _, s := range steps {
+		if err := d.command(s.command, s.data...); err != nil {
+			return err
+		}
+	}
+	d.Sleep(100 * time.Millisecond)
+	if err := d.waitUntilIdle(); err != nil {
+		return err
+	}
+	steps = []struct {
+		command byte
+		data    []byte
+	}{
+		{panelSetting, []byte{0x1f}},
+		{resolution, []byte{Width >> 8, Width & 0xff, Height >> 8, Height & 0xff}},
+		{dualSPI, []byte{0x00}},
+		{vcomInterval, []byte{0x10, 0x07}},
+		{tcon, []byte{0x22}},
+	}
+	for _, s := range steps {
+		if err := d.command(s.command, s.data...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Display does a full refresh with image, which is one bit per pixel with
+// 1 as white, the format of Screen.OneBitImage
+func (d *Display) Display(image []byte) error {
+	if len(image) != Width*Height/8 {
+		return fmt.Errorf("epd: image is %d bytes, expected %d", len(image), Width*Height/8)
+	}
+	// the new data register takes 1 as black
+	inverted := make([]byte, len(image))
+	for i, b := range image {
+		inverted[i] = ^b
+	}
+	if err := d.command(oldData); err != nil {
+		return err
+	}
+	if err := d.data(image); err != nil {
+		return err
+	}
+	if err := d.command(newData); err != nil {
+		return err
+	}
+	if err := d.data(inverted); err != nil {
+		return err
+	}
+	return d.refresh()
+}
+
+// DisplayPartial refreshes only the window of the panel, which has to start
+// and end on a multiple of 8 pixels horizontally. previous is the frame
+// currently on the panel and frame the new one, both whole frames in the
+// same format as Display takes
+func (d *Display) DisplayPartial(previous, frame []byte, window image.Rectangle) error {
+	size := Width * Height / 8
+	if len(frame) != size || len(previous) != size {
+		return fmt.Errorf("epd: frames must be %d bytes", size)
+	}
+	window = window.Intersect(imageBounds)
+	if window.Min.X%8 != 0 || window.Max.X%8 != 0 {
+		return fmt.Errorf("epd: partial window %v is not byte aligned", window)
+	}
+	if window.Empty() {
+		return nil
+	}
+	x1, x2 := window.Min.X, window.Max.X-1
+	y1, y2 := window.Min.Y, window.Max.Y-1
+	steps := []struct {
+		command byte
+		data    []byte
+	}{
+		{vcomInterval, []byte{0xa9, 0x07}},
+		{partialIn, nil},
+		{partialWindow, []byte{
+			byte(x1 >> 8), byte(x1), byte(x2 >> 8), byte(x2),
+			byte(y1 >> 8), byte(y1), byte(y2 >> 8), byte(y2), 0x01}},
+	}
+	for _, s := range steps {
+		if err := d.command(s.command, s.data...); err != nil {
+			return err
+		}
+	}
+
+	var old, current []byte
+	for y := window.Min.Y; y < window.Max.Y; y++ {
+		row := y * Width / 8
+		for col := window.Min.X / 8; col < window.Max.X/8; col++ {
+			old = append(old, previous[row+col])
+			current = append(current, ^frame[row+col])
+		}
+	}
+	if err := d.command(oldData); err != nil {
+		return err
+	}
+	if err := d.data(old); err != nil {
+		return err
+	}
+	if err := d.command(newData); err != nil {
+		return err
+	}
+	if err := d.data(current); err != nil {
+		return err
+	}
+	if err := d.refresh(); err != nil {
+		return err
+	}
+	return d.command(partialOut)
+}
+
+// Clear sets the whole panel to white
+func (d *Display) Clear() error {
+	white := make([]byte, Width*Height/8)
+	for i := range white {
+		white[i] = 0xff
+	}
+	return d.Display(white)
+}
+
+func (d *Display) refresh() error {
+	if err := d.command(displayRefresh); err != nil {
+		return err
+	}
+	d.Sleep(100 * time.Millisecond)
+	return d.waitUntilIdle()
+}
+
+// DeepSleep powers the panel down, it needs a Reset or Init to wake up
+func (d *Display) DeepSleep() error {
+	if err := d.command(powerOff); err != nil {
+		return err
+	}
+	if err := d.waitUntilIdle(); err != nil {
+		return err
+	}
+	return d.command(deepSleep, 0xa5)
+}
+
+func (d *Display) Close() error {
+	return d.bus.Close()
+}
@@ -0,0 +1,238 @@
+package epd
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"testing"
+	"time"
+)
+
+// sent is a command and the data written after it
+type sent struct {
+	command byte
+	data    []byte
+}
+
+// fakeBus records what is sent to the panel, grouping the data with the
+// command it follows
+type fakeBus struct {
+	dc     bool
+	sent   []sent
+	resets []bool
+	// busy says whether the panel is busy at each poll, idle when nil
+	busy   func() bool
+	closed bool
+}
+
+func (b *fakeBus) Write(data []byte) error {
+	if !b.dc {
+		for _, c := range data {
+			b.sent = append(b.sent, sent{command: c})
+		}
+		return nil
+	}
+	if len(b.sent) == 0 {
+		return errors.New("data before a command")
+	}
+	last := &b.sent[len(b.sent)-1]
+	last.data = append(last.data, data...)
+	return nil
+}
+
+func (b *fakeBus) SetDC(high bool) error {
+	b.dc = high
+	return nil
+}
+
+func (b *fakeBus) SetReset(high bool) error {
+	b.resets = append(b.resets, high)
+	return nil
+}
+
+func (b *fakeBus) Busy() (bool, error) {
+	if b.busy == nil {
+		return false, nil
+	}
+	return b.busy(), nil
+}
+
+func (b *fakeBus) Close() error {
+	b.closed = true
+	return nil
+}
+
+// commands leaves out the status polls, which depend on the timing
+func (b *fakeBus) commands() []sent {
+	var out []sent
+	for _, s := range b.sent {
+		if s.command != getStatus {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func newFake() (*Display, *fakeBus, *[]time.Duration) {
+	bus := new(fakeBus)
+	d := New(bus)
+	var slept []time.Duration
+	d.Sleep = func(t time.Duration) { slept = append(slept, t) }
+	return d, bus, &slept
+}
+
+func checkSent(t *testing.T, got, want []sent) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("sent %d commands, want %d: %x", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i].command != want[i].command || !bytes.Equal(got[i].data, want[i].data) {
+			t.Errorf("command %d is %#02x % x, want %#02x % x", i, got[i].command, got[i].data, want[i].command, want[i].data)
+		}
+	}
+}
+
+func TestInit(t *testing.T) {
+	d, bus, slept := newFake()
+	if err := d.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []bool{true, false, true}; len(bus.resets) != 3 || bus.resets[0] != want[0] || bus.resets[1] != want[1] || bus.resets[2] != want[2] {
+		t.Errorf("reset pin went %v, want %v", bus.resets, want)
+	}
+	checkSent(t, bus.commands(), []sent{
+		{powerSetting, []byte{0x07, 0x07, 0x3f, 0x3f}},
+		{boosterSoftStart, []byte{0x17, 0x17, 0x28, 0x17}},
+		{powerOn, nil},
+		{panelSetting, []byte{0x1f}},
+		{resolution, []byte{0x03, 0x20, 0x01, 0xe0}},
+		{dualSPI, []byte{0x00}},
+		{vcomInterval, []byte{0x10, 0x07}},
+		{tcon, []byte{0x22}},
+	})
+	if len(*slept) == 0 {
+		t.Error("never waited for the panel")
+	}
+}
+
+func TestDisplay(t *testing.T) {
+	d, bus, _ := newFake()
+	frame := make([]byte, Width*Height/8)
+	for i := range frame {
+		frame[i] = byte(i)
+	}
+	if err := d.Display(frame); err != nil {
+		t.Fatal(err)
+	}
+	inverted := make([]byte, len(frame))
+	for i, b := range frame {
+		inverted[i] = ^b
+	}
+	checkSent(t, bus.commands(), []sent{
+		{oldData, frame},
+		{newData, inverted},
+		{displayRefresh, nil},
+	})
+
+	if err := d.Display(frame[:10]); err == nil {
+		t.Error("displayed a short frame")
+	}
+}
+
+func TestDisplayPartial(t *testing.T) {
+	d, bus, _ := newFake()
+	previous := make([]byte, Width*Height/8)
+	frame := make([]byte, Width*Height/8)
+	for i := range frame {
+		previous[i] = 0xff
+		frame[i] = 0xff
+	}
+	// two bytes wide and two rows high at x 16, y 300
+	window := image.Rect(16, 300, 32, 302)
+	row := 300 * Width / 8
+	frame[row+2], frame[row+3] = 0x0f, 0xf0
+	frame[row+Width/8+2], frame[row+Width/8+3] = 0x00, 0xaa
+	previous[row+2] = 0x55
+
+	if err := d.DisplayPartial(previous, frame, window); err != nil {
+		t.Fatal(err)
+	}
+	checkSent(t, bus.commands(), []sent{
+		{vcomInterval, []byte{0xa9, 0x07}},
+		{partialIn, nil},
+		// x 16 to 31 and y 300 to 301, inclusive
+		{partialWindow, []byte{0x00, 0x10, 0x00, 0x1f, 0x01, 0x2c, 0x01, 0x2d, 0x01}},
+		{oldData, []byte{0x55, 0xff, 0xff, 0xff}},
+		{newData, []byte{0xf0, 0x0f, 0xff, 0x55}},
+		{displayRefresh, nil},
+		{partialOut, nil},
+	})
+}
+
+func TestDisplayPartialWindow(t *testing.T) {
+	d, bus, _ := newFake()
+	frame := make([]byte, Width*Height/8)
+	if err := d.DisplayPartial(frame, frame, image.Rect(4, 0, 16, 8)); err == nil {
+		t.Error("accepted a window not on a byte boundary")
+	}
+	// outside the panel it is clipped to nothing
+	if err := d.DisplayPartial(frame, frame, image.Rect(Width, 0, Width+8, 8)); err != nil {
+		t.Error(err)
+	}
+	if len(bus.sent) != 0 {
+		t.Errorf("sent %x", bus.sent)
+	}
+}
+
+func TestDeepSleep(t *testing.T) {
+	d, bus, _ := newFake()
+	if err := d.DeepSleep(); err != nil {
+		t.Fatal(err)
+	}
+	checkSent(t, bus.commands(), []sent{
+		{powerOff, nil},
+		{deepSleep, []byte{0xa5}},
+	})
+	// the status is polled before sleeping
+	if bus.sent[1].command != getStatus {
+		t.Errorf("sent %x", bus.sent)
+	}
+}
+
+func TestBusyWait(t *testing.T) {
+	d, bus, slept := newFake()
+	polls := 0
+	bus.busy = func() bool {
+		polls++
+		return polls < 3
+	}
+	if err := d.DeepSleep(); err != nil {
+		t.Fatal(err)
+	}
+	if polls != 3 {
+		t.Errorf("polled %d times, want 3", polls)
+	}
+	// a wait after each busy poll and one once idle
+	if len(*slept) != 3 {
+		t.Errorf("slept %v", *slept)
+	}
+}
+
+func TestBusyTimeout(t *testing.T) {
+	timeout := BusyTimeout
+	defer func() { BusyTimeout = timeout }()
+	BusyTimeout = 0
+
+	d, bus, slept := newFake()
+	bus.busy = func() bool { return true }
+	if err := d.DeepSleep(); err != ErrBusyTimeout {
+		t.Errorf("got %v, want ErrBusyTimeout", err)
+	}
+	if len(*slept) != 0 {
+		t.Errorf("slept %v after timing out", *slept)
+	}
+	if err := d.Close(); err != nil || !bus.closed {
+		t.Error("bus not closed")
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const energiDataServiceURL = "https://api.energidataservice.dk"
+
+// PriceFetcher gets day-ahead spot prices from Energi Data Service
+type PriceFetcher struct {
+	BaseURL string
+	Client  *http.Client
+	// Dataset is DayAheadPrices (15 minute prices) or the older Elspotprices
+	// (hourly, until October 2025)
+	Dataset string
+	// Area is the bidding area, e.g. DK1 or DK2
+	Area string
+	// Resolution is the length of the stored intervals, prices are averaged
+	// up to it but never split below what the dataset gives
+	Resolution time.Duration
+}
+
+type energiDataServiceData struct {
+	Records []energiDataServiceRecord
+}
+
+type energiDataServiceRecord struct {
+	TimeUTC          string
+	HourUTC          string
+	PriceArea        string
+	DayAheadPriceDKK *float64
+	SpotPriceDKK     *float64
+	Minutes5UTC      string
+	CO2Emission      *float64
+}
+
+func NewPriceFetcher(config *Config) *PriceFetcher {
+	return &PriceFetcher{
+		BaseURL:    energiDataServiceURL,
+		Client:     http.DefaultClient,
+		Dataset:    config.PriceDataset,
+		Area:       config.PriceArea,
+		Resolution: config.PriceStep,
+	}
+}
+
+func (f *PriceFetcher) interval() time.Duration {
+	if f.Dataset == "Elspotprices" {
+		return time.Hour
+	}
+	return 15 * time.Minute
+}
+
+// Fetch returns the spot prices between start and end in DKK/kWh, tariffs
+// and VAT are added when they are shown
+func (f *PriceFetcher) Fetch(start, end time.Time) ([]PriceInterval, error) {
+	resp, err := f.Client.Get(f.url(start, end))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("energi data service: %s", resp.Status)
+	}
+	var prices energiDataServiceData
+	err = json.NewDecoder(resp.Body).Decode(&prices)
+	if err != nil {
+		return nil, fmt.Errorf("energi data service: %w", err)
+	}
+
+	var intervals []PriceInterval
+	for _, r := range prices.Records {
+		stamp, price := r.TimeUTC, r.DayAheadPriceDKK
+		if f.Dataset == "Elspotprices" {
+			stamp, price = r.HourUTC, r.SpotPriceDKK
+		}
+		if price == nil {
+			continue
+		}
+		t, err := time.Parse("2006-01-02T15:04:05", stamp)
+		if err != nil {
+			return nil, fmt.Errorf("energi data service: %w", err)
+		}
+		intervals = append(intervals, PriceInterval{
+			Start: t,
+			End:   t.Add(f.interval()),
+			// prices are given per MWh
+			Price: *price / 1000,
+		})
+	}
+	resolution := f.Resolution
+	if resolution < f.interval() {
+		resolution = f.interval()
+	}
+	return aggregatePrices(intervals, resolution), nil
+}
+
+func (f *PriceFetcher) url(start, end time.Time) string {
+	timeField := "TimeUTC"
+	if f.Dataset == "Elspotprices" {
+		timeField = "HourUTC"
+	}
+	return datasetURL(f.BaseURL, f.Dataset, timeField, f.Area, start, end)
+}
+
+// datasetURL is the query for a dataset's records in an area between start
+// and end, sorted by timeField
+func datasetURL(base, dataset, timeField, area string, start, end time.Time) string {
+	query := url.Values{}
+	// times are given in UTC so nothing is lost around daylight savings
+	query.Set("start", start.UTC().Format("2006-01-02T15:04"))
+	query.Set("end", end.UTC().Format("2006-01-02T15:04"))
+	query.Set("timezone", "utc")
+	query.Set("filter", `{"PriceArea":["`+area+`"]}`)
+	query.Set("sort", timeField+" asc")
+	query.Set("limit", "0")
+	return base + "/dataset/" + dataset + "?" + query.Encode()
+}
+
+// FetchPrices stores the prices for the configured area from the start of
+// yesterday until the end of tomorrow
+func FetchPrices(config *Config, power *Power) error {
+	if config.PriceArea == "" {
+		return errors.New("no price area configured")
+	}
+	now := time.Now().In(config.Location)
+	start := time.Date(now.Year(), now.Month(), now.Day()-1, 0, 0, 0, 0, config.Location)
+	end := time.Date(now.Year(), now.Month(), now.Day()+2, 0, 0, 0, 0, config.Location)
+	prices, err := NewPriceFetcher(config).Fetch(start, end)
+	if err != nil {
+		return err
+	}
+	return power.StorePrices(prices)
+}
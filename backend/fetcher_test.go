@@ -0,0 +1,152 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testPower is an empty database in the test's temporary directory
+func testPower(t *testing.T, loc *time.Location) *Power {
+	t.Helper()
+	power, err := NewPower(filepath.Join(t.TempDir(), "test.db"), loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { power.Db.Close() })
+	return power
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+// checkPrices compares intervals with want, given as their start in UTC and
+// price
+func checkPrices(t *testing.T, got []PriceInterval, length time.Duration, want map[string]float64) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d intervals %v, want %d", len(got), got, len(want))
+	}
+	for _, p := range got {
+		start := p.Start.UTC().Format("2006-01-02T15:04")
+		price, ok := want[start]
+		if !ok {
+			t.Errorf("unexpected interval from %s", start)
+			continue
+		}
+		if !near(p.Price, price) {
+			t.Errorf("price from %s is %v, want %v", start, p.Price, price)
+		}
+		if p.End.Sub(p.Start) != length {
+			t.Errorf("interval from %s is %s long, want %s", start, p.End.Sub(p.Start), length)
+		}
+	}
+}
+
+func TestFetchDayAheadPrices(t *testing.T) {
+	server, requested := fixtureServer(t, "dayaheadprices.json")
+	loc := copenhagen(t)
+	start := time.Date(2026, 1, 18, 0, 0, 0, 0, loc)
+	end := start.AddDate(0, 0, 1)
+
+	tests := []struct {
+		resolution time.Duration
+		want       map[string]float64
+	}{
+		// the missing price at 01:45 is left out
+		{15 * time.Minute, map[string]float64{
+			"2026-01-18T00:00": 0.4, "2026-01-18T00:15": 0.6, "2026-01-18T00:30": 0.8, "2026-01-18T00:45": 1,
+			"2026-01-18T01:00": -0.1, "2026-01-18T01:15": 0.1, "2026-01-18T01:30": 0.3,
+		}},
+		// and leaves the half hour and hour it is in incomplete
+		{30 * time.Minute, map[string]float64{
+			"2026-01-18T00:00": 0.5, "2026-01-18T00:30": 0.9, "2026-01-18T01:00": 0,
+		}},
+		{time.Hour, map[string]float64{"2026-01-18T00:00": 0.7}},
+	}
+	for _, test := range tests {
+		f := &PriceFetcher{BaseURL: server.URL, Client: server.Client(), Dataset: "DayAheadPrices", Area: "DK1", Resolution: test.resolution}
+		prices, err := f.Fetch(start, end)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkPrices(t, prices, test.resolution, test.want)
+	}
+
+	u, err := url.Parse(*requested)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := u.Query()
+	if u.Path != "/dataset/DayAheadPrices" {
+		t.Errorf("requested %s", u.Path)
+	}
+	// local midnight in winter is 23:00 UTC
+	if query.Get("start") != "2026-01-17T23:00" || query.Get("end") != "2026-01-18T23:00" {
+		t.Errorf("requested %s until %s", query.Get("start"), query.Get("end"))
+	}
+	if query.Get("filter") != `{"PriceArea":["DK1"]}` || query.Get("sort") != "TimeUTC asc" {
+		t.Errorf("requested %s", *requested)
+	}
+}
+
+func TestFetchElspotprices(t *testing.T) {
+	server, requested := fixtureServer(t, "elspotprices.json")
+	loc := copenhagen(t)
+	start := time.Date(2025, 3, 30, 0, 0, 0, 0, loc)
+	// hourly prices are never split into quarters
+	f := &PriceFetcher{BaseURL: server.URL, Client: server.Client(), Dataset: "Elspotprices", Area: "DK2", Resolution: 15 * time.Minute}
+	prices, err := f.Fetch(start, start.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPrices(t, prices, time.Hour, map[string]float64{
+		"2025-03-30T00:00": 0.51234, "2025-03-30T01:00": 0.4899, "2025-03-30T02:00": -0.0125,
+	})
+	u, err := url.Parse(*requested)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Path != "/dataset/Elspotprices" || u.Query().Get("sort") != "HourUTC asc" {
+		t.Errorf("requested %s", *requested)
+	}
+}
+
+func TestFetchPricesError(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+	f := &PriceFetcher{BaseURL: server.URL, Client: server.Client(), Dataset: "DayAheadPrices", Area: "DK1"}
+	if _, err := f.Fetch(time.Now(), time.Now().Add(time.Hour)); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("got %v, want a 404 error", err)
+	}
+}
+
+func TestStorePrices(t *testing.T) {
+	server, _ := fixtureServer(t, "dayaheadprices.json")
+	loc := copenhagen(t)
+	power := testPower(t, loc)
+	start := time.Date(2026, 1, 18, 0, 0, 0, 0, loc)
+	end := start.AddDate(0, 0, 1)
+	f := &PriceFetcher{BaseURL: server.URL, Client: server.Client(), Dataset: "DayAheadPrices", Area: "DK1", Resolution: time.Hour}
+	for i := 0; i < 2; i++ {
+		prices, err := f.Fetch(start, end)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = power.StorePrices(prices); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// fetching again replaces the prices, and they are stored as spot prices
+	stored, err := power.PricesBetween(start, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPrices(t, stored, time.Hour, map[string]float64{"2026-01-18T00:00": 0.7})
+}
@@ -4,6 +4,6 @@ go 1.15
 
 require (
 	github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0
-	github.com/mattn/go-sqlite3 v1.14.6 // indirect
+	github.com/mattn/go-sqlite3 v1.14.6
 	golang.org/x/image v0.0.0-20210216034530-4410531fe030
 )
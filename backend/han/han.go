@@ -0,0 +1,408 @@
+// Package han reads the DLMS/COSEM push messages smart meters send out of
+// their HAN port, e.g. the Kamstrup Omnipower which pushes the current power
+// every 10 seconds and the meter readings every hour
+package han
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	flag = 0x7e
+	// frames start with the type 3 frame format
+	formatType = 0xa0
+	// segmented frames have the rest of the message in the next frame
+	formatSegmented = 0x08
+)
+
+// DLMS APDU tags
+const (
+	dataNotification     = 0x0f
+	generalGloCiphering  = 0xdb
+	securityAuthenticate = 0x10
+	securityEncrypt      = 0x20
+)
+
+var (
+	// ErrChecksum is returned for frames that were garbled on the way
+	ErrChecksum = errors.New("han: bad frame checksum")
+	// ErrNoKey is returned for encrypted messages when no key is set
+	ErrNoKey = errors.New("han: message is encrypted but no key is set")
+	// errShort is kept apart from io.ErrUnexpectedEOF, which is the port
+	// closing part way through a frame
+	errShort = errors.New("message ends early")
+)
+
+// Measurement is what the meter pushed in one message. Power is in W and
+// energy in kWh, the energy registers are only in some messages
+type Measurement struct {
+	Time time.Time
+	// Import and Export are the active power being drawn from and fed into
+	// the grid
+	Import float64
+	Export float64
+	// HasEnergy is set when the message had the meter readings
+	HasEnergy    bool
+	ImportEnergy float64
+	ExportEnergy float64
+}
+
+// Reader decodes the HDLC framed messages from a HAN port
+type Reader struct {
+	r *bufio.Reader
+	// Key is the 16 byte encryption key from the grid company, for meters
+	// that encrypt their messages
+	Key []byte
+	// AuthKey is the authentication key, when set encrypted messages are
+	// checked with it, otherwise they are only decrypted
+	AuthKey []byte
+	// EnergyUnit is the Wh counted by each step of the energy registers, the
+	// Kamstrup meters count in 10 Wh steps
+	EnergyUnit float64
+	// Now is the time given to measurements, the meter's own clock is not
+	// always set
+	Now func() time.Time
+}
+
+// NewReader reads frames from r, e.g. a serial port opened with OpenSerial
+func NewReader(r io.Reader) *Reader {
+	return &Reader{
+		r:          bufio.NewReader(r),
+		EnergyUnit: 1,
+		Now:        time.Now,
+	}
+}
+
+// Next returns the next message's measurement. Errors other than those
+// from reading the port only affect that message, so reading can carry on
+func (reader *Reader) Next() (*Measurement, error) {
+	var message []byte
+	for {
+		info, segmented, err := reader.frame()
+		if err != nil {
+			return nil, err
+		}
+		message = append(message, info...)
+		if !segmented {
+			break
+		}
+	}
+	// the message starts with an LLC header
+	if len(message) < 3 || message[0] != 0xe6 || message[1] != 0xe7 {
+		return nil, errors.New("han: message has no LLC header")
+	}
+	apdu, err := reader.decrypt(message[3:])
+	if err != nil {
+		return nil, err
+	}
+	return reader.measurement(apdu)
+}
+
+// frame reads the next HDLC frame and returns its information field
+func (reader *Reader) frame() (info []byte, segmented bool, err error) {
+	for {
+		b, err := reader.r.ReadByte()
+		if err != nil {
+			return nil, false, err
+		}
+		if b != flag {
+			continue
+		}
+		format, err := reader.r.Peek(2)
+		if err != nil {
+			return nil, false, err
+		}
+		// a flag can close one frame and open the next, or there can be two
+		if format[0]&0xf0 != formatType {
+			continue
+		}
+		length := int(format[0]&0x07)<<8 | int(format[1])
+		frame := make([]byte, length)
+		_, err = io.ReadFull(reader.r, frame)
+		if err != nil {
+			return nil, false, err
+		}
+		// the closing flag is left in case it also opens the next frame
+		if next, err := reader.r.Peek(1); err == nil && next[0] != flag {
+			return nil, false, errors.New("han: frame is not closed")
+		}
+		info, err = parseFrame(frame)
+		return info, frame[0]&formatSegmented != 0, err
+	}
+}
+
+// parseFrame checks a frame, without its flags, and returns the
+// information field
+func parseFrame(frame []byte) ([]byte, error) {
+	if len(frame) < 7 {
+		return nil, errors.New("han: frame too short")
+	}
+	if fcs(frame[:len(frame)-2]) != binary.LittleEndian.Uint16(frame[len(frame)-2:]) {
+		return nil, ErrChecksum
+	}
+	// the format, then destination and source addresses which end with the
+	// low bit set, and the control field
+	i := 2
+	for a := 0; a < 2; a++ {
+		for i < len(frame) && frame[i]&1 == 0 {
+			i++
+		}
+		i++
+	}
+	i++
+	if i+2 > len(frame)-2 {
+		return nil, nil
+	}
+	if fcs(frame[:i]) != binary.LittleEndian.Uint16(frame[i:]) {
+		return nil, ErrChecksum
+	}
+	return frame[i+2 : len(frame)-2], nil
+}
+
+// fcs is the CRC-16/X.25 frame check sequence
+func fcs(data []byte) uint16 {
+	crc := uint16(0xffff)
+	for _, b := range data {
+		crc ^= uint16(b)
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0x8408
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return ^crc
+}
+
+// decrypt unwraps a general-glo-ciphering APDU, other APDUs are returned
+// as they are
+func (reader *Reader) decrypt(apdu []byte) ([]byte, error) {
+	if len(apdu) == 0 || apdu[0] != generalGloCiphering {
+		return apdu, nil
+	}
+	if len(reader.Key) == 0 {
+		return nil, ErrNoKey
+	}
+	d := decoder{data: apdu[1:]}
+	titleLength := d.byte()
+	title := d.bytes(int(titleLength))
+	length := d.length()
+	if d.err != nil || length < 5 || length > len(d.data) {
+		return nil, errors.New("han: encrypted message too short")
+	}
+	body := d.bytes(length)
+	security, counter, ciphertext := body[0], body[1:5], body[5:]
+	if security&securityEncrypt == 0 {
+		return nil, fmt.Errorf("han: unsupported security control %#x", security)
+	}
+
+	block, err := aes.NewCipher(reader.Key)
+	if err != nil {
+		return nil, fmt.Errorf("han: %w", err)
+	}
+	iv := append(append([]byte{}, title...), counter...)
+	if len(iv) != 12 {
+		return nil, errors.New("han: system title must be 8 bytes")
+	}
+	tagged := security&securityAuthenticate != 0
+	if tagged && len(reader.AuthKey) > 0 {
+		gcm, err := cipher.NewGCMWithTagSize(block, 12)
+		if err != nil {
+			return nil, fmt.Errorf("han: %w", err)
+		}
+		additional := append([]byte{security}, reader.AuthKey...)
+		plain, err := gcm.Open(nil, iv, ciphertext, additional)
+		if err != nil {
+			return nil, fmt.Errorf("han: %w", err)
+		}
+		return plain, nil
+	}
+
+	// without the authentication key the tag cannot be checked, but GCM is
+	// counter mode underneath so the message can still be read
+	if tagged {
+		if len(ciphertext) < 12 {
+			return nil, errors.New("han: encrypted message too short")
+		}
+		ciphertext = ciphertext[:len(ciphertext)-12]
+	}
+	counterBlock := append(iv, 0, 0, 0, 2)
+	plain := make([]byte, len(ciphertext))
+	cipher.NewCTR(block, counterBlock).XORKeyStream(plain, ciphertext)
+	return plain, nil
+}
+
+// measurement picks the power and energy values out of a data-notification
+func (reader *Reader) measurement(apdu []byte) (*Measurement, error) {
+	d := decoder{data: apdu}
+	if tag := d.byte(); tag != dataNotification {
+		return nil, fmt.Errorf("han: unsupported APDU %#x", tag)
+	}
+	// long-invoke-id-and-priority, then an optional date-time
+	d.bytes(4)
+	if n := d.byte(); n != 0 {
+		d.bytes(int(n))
+	}
+	var values []value
+	d.walk(&values)
+	if d.err != nil {
+		return nil, fmt.Errorf("han: %w", d.err)
+	}
+
+	m := &Measurement{Time: reader.Now()}
+	found := false
+	for i := 0; i+1 < len(values); i++ {
+		obis := values[i].octets
+		if len(obis) != 6 || !values[i+1].numeric {
+			continue
+		}
+		v := values[i+1].number
+		// a scaler and unit can follow the value
+		if i+3 < len(values) && values[i+2].scaler && values[i+3].numeric {
+			v *= pow10(int(values[i+2].number))
+		}
+		// only the C, D and E groups matter, meters differ on the rest
+		switch [3]byte{obis[2], obis[3], obis[4]} {
+		case [3]byte{1, 7, 0}:
+			m.Import = v
+		case [3]byte{2, 7, 0}:
+			m.Export = v
+		case [3]byte{1, 8, 0}:
+			m.ImportEnergy = v * reader.EnergyUnit / 1000
+			m.HasEnergy = true
+		case [3]byte{2, 8, 0}:
+			m.ExportEnergy = v * reader.EnergyUnit / 1000
+		default:
+			continue
+		}
+		found = true
+	}
+	if !found {
+		return nil, errors.New("han: no power values in message")
+	}
+	return m, nil
+}
+
+func pow10(n int) float64 {
+	v := 1.0
+	for ; n > 0; n-- {
+		v *= 10
+	}
+	for ; n < 0; n++ {
+		v /= 10
+	}
+	return v
+}
+
+// value is one leaf of the COSEM data in a message
+type value struct {
+	octets  []byte
+	numeric bool
+	number  float64
+	// scaler is set for the int8 that starts a scaler and unit structure
+	scaler bool
+}
+
+// decoder reads A-XDR encoded data, remembering the first error
+type decoder struct {
+	data []byte
+	err  error
+}
+
+func (d *decoder) bytes(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(d.data) {
+		d.err = errShort
+		return nil
+	}
+	b := d.data[:n]
+	d.data = d.data[n:]
+	return b
+}
+
+func (d *decoder) byte() byte {
+	b := d.bytes(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+// length reads a variable length quantity, one byte up to 127 otherwise
+// 0x80 plus the number of bytes that follow
+func (d *decoder) length() int {
+	n := int(d.byte())
+	if n&0x80 == 0 {
+		return n
+	}
+	length := 0
+	for _, b := range d.bytes(n & 0x7f) {
+		length = length<<8 | int(b)
+	}
+	return length
+}
+
+func (d *decoder) uint(n int) uint64 {
+	var v uint64
+	for _, b := range d.bytes(n) {
+		v = v<<8 | uint64(b)
+	}
+	return v
+}
+
+// walk appends the leaves of one data item to values
+func (d *decoder) walk(values *[]value) {
+	tag := d.byte()
+	if d.err != nil {
+		return
+	}
+	switch tag {
+	case 0x00:
+		// null
+	case 0x01, 0x02:
+		// array and structure
+		count := d.length()
+		scaler := tag == 0x02 && count == 2 && len(d.data) > 0 && d.data[0] == 0x0f
+		for i := 0; i < count && d.err == nil; i++ {
+			d.walk(values)
+			if i == 0 && scaler && len(*values) > 0 {
+				(*values)[len(*values)-1].scaler = true
+			}
+		}
+	case 0x03, 0x11, 0x16:
+		// boolean, unsigned and enum
+		*values = append(*values, value{numeric: true, number: float64(d.uint(1))})
+	case 0x0f:
+		*values = append(*values, value{numeric: true, number: float64(int8(d.uint(1)))})
+	case 0x10:
+		*values = append(*values, value{numeric: true, number: float64(int16(d.uint(2)))})
+	case 0x12:
+		*values = append(*values, value{numeric: true, number: float64(d.uint(2))})
+	case 0x05:
+		*values = append(*values, value{numeric: true, number: float64(int32(d.uint(4)))})
+	case 0x06:
+		*values = append(*values, value{numeric: true, number: float64(d.uint(4))})
+	case 0x14:
+		*values = append(*values, value{numeric: true, number: float64(int64(d.uint(8)))})
+	case 0x15:
+		*values = append(*values, value{numeric: true, number: float64(d.uint(8))})
+	case 0x09, 0x0a:
+		// octet and visible strings
+		*values = append(*values, value{octets: d.bytes(d.length())})
+	case 0x19:
+		// date-time
+		*values = append(*values, value{octets: d.bytes(12)})
+	default:
+		d.err = fmt.Errorf("unsupported data type %#x", tag)
+	}
+}
@@ -0,0 +1,160 @@
+package han
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fixture reads bytes captured from a port, written out as hex with #
+// comments
+func fixture(t *testing.T, name string) *Reader {
+	t.Helper()
+	f, err := os.Open("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var data []byte
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		b, err := hex.DecodeString(strings.ReplaceAll(line, " ", ""))
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = append(data, b...)
+	}
+	if err = scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	reader := NewReader(bytes.NewReader(data))
+	reader.Now = func() time.Time { return time.Date(2026, 1, 18, 10, 0, 15, 0, time.UTC) }
+	return reader
+}
+
+func mustHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+var (
+	testKey     = mustHex("000102030405060708090a0b0c0d0e0f")
+	testAuthKey = mustHex("d0d1d2d3d4d5d6d7d8d9dadbdcdddedf")
+)
+
+func TestKamstrupList(t *testing.T) {
+	reader := fixture(t, "kamstrup-list1.hex")
+	m, err := reader.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Measurement{Time: reader.Now(), Import: 1234}
+	if *m != want {
+		t.Errorf("got %+v, want %+v", *m, want)
+	}
+	if _, err = reader.Next(); err != io.EOF {
+		t.Errorf("got %v at the end, want EOF", err)
+	}
+}
+
+func TestKamstrupHourlyList(t *testing.T) {
+	reader := fixture(t, "kamstrup-list2.hex")
+	reader.EnergyUnit = 10
+	m, err := reader.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Measurement{Time: reader.Now(), Import: 987, HasEnergy: true, ImportEnergy: 12345.67, ExportEnergy: 43.21}
+	if *m != want {
+		t.Errorf("got %+v, want %+v", *m, want)
+	}
+}
+
+func TestSegmentedFrame(t *testing.T) {
+	reader := fixture(t, "segmented.hex")
+	reader.EnergyUnit = 10
+	m, err := reader.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Import != 987 || !m.HasEnergy || m.ImportEnergy != 12345.67 {
+		t.Errorf("got %+v", *m)
+	}
+	if _, err = reader.Next(); err != io.EOF {
+		t.Errorf("got %v after the second segment, want EOF", err)
+	}
+}
+
+func TestBadChecksum(t *testing.T) {
+	for _, name := range []string{"bad-fcs.hex", "bad-hcs.hex"} {
+		reader := fixture(t, name)
+		if _, err := reader.Next(); err != ErrChecksum {
+			t.Errorf("%s: got %v, want ErrChecksum", name, err)
+		}
+		// the frame after it is read as normal
+		m, err := reader.Next()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if m.Import != 1234 {
+			t.Errorf("%s: got %+v", name, *m)
+		}
+	}
+}
+
+func TestEncrypted(t *testing.T) {
+	tests := []struct {
+		name         string
+		key, authKey []byte
+		err          error
+	}{
+		{"no key", nil, nil, ErrNoKey},
+		// without the authentication key the message is only decrypted
+		{"key only", testKey, nil, nil},
+		{"both keys", testKey, testAuthKey, nil},
+		{"wrong authentication key", testKey, testKey, errors.New("message authentication failed")},
+	}
+	for _, test := range tests {
+		reader := fixture(t, "encrypted.hex")
+		reader.Key = test.key
+		reader.AuthKey = test.authKey
+		m, err := reader.Next()
+		switch {
+		case test.err == nil && err != nil:
+			t.Errorf("%s: %v", test.name, err)
+		case test.err == nil && m.Import != 2345:
+			t.Errorf("%s: got %+v", test.name, *m)
+		case test.err != nil && (err == nil || !strings.Contains(err.Error(), test.err.Error())):
+			t.Errorf("%s: got %v, want %v", test.name, err, test.err)
+		}
+	}
+}
+
+func TestWrongKey(t *testing.T) {
+	reader := fixture(t, "encrypted.hex")
+	reader.Key = testAuthKey
+	// decrypted with the wrong key the message is garbage
+	if _, err := reader.Next(); err == nil {
+		t.Error("read a message with the wrong key")
+	}
+}
+
+func TestFCS(t *testing.T) {
+	// the CRC-16/X.25 check value
+	if got := fcs([]byte("123456789")); got != 0x906e {
+		t.Errorf("got %#04x, want 0x906e", got)
+	}
+}
@@ -0,0 +1,44 @@
+package han
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var bauds = map[int]uint32{
+	1200:   syscall.B1200,
+	2400:   syscall.B2400,
+	4800:   syscall.B4800,
+	9600:   syscall.B9600,
+	19200:  syscall.B19200,
+	38400:  syscall.B38400,
+	115200: syscall.B115200,
+}
+
+// OpenSerial opens a serial device, e.g. /dev/ttyUSB0, raw at 8N1 and the
+// given baud rate. Kamstrup meters send at 2400 baud
+func OpenSerial(device string, baud int) (*os.File, error) {
+	speed, ok := bauds[baud]
+	if !ok {
+		return nil, fmt.Errorf("han: unsupported baud rate %d", baud)
+	}
+	port, err := os.OpenFile(device, os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, err
+	}
+	termios := syscall.Termios{
+		Cflag:  speed | syscall.CS8 | syscall.CREAD | syscall.CLOCAL,
+		Ispeed: speed,
+		Ospeed: speed,
+	}
+	// block until at least a byte has arrived
+	termios.Cc[syscall.VMIN] = 1
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, port.Fd(), syscall.TCSETS, uintptr(unsafe.Pointer(&termios)))
+	if errno != 0 {
+		port.Close()
+		return nil, fmt.Errorf("han: configuring %s: %w", device, errno)
+	}
+	return port, nil
+}
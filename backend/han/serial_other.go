@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package han
+
+import (
+	"errors"
+	"os"
+)
+
+// OpenSerial is only supported on Linux
+func OpenSerial(device string, baud int) (*os.File, error) {
+	return nil, errors.New("han: reading the serial port needs Linux")
+}
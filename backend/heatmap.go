@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"time"
+)
+
+// Heatmap is the average kWh used in each hour of the week, Monday first
+type Heatmap [7][24]float64
+
+// HourOfWeek averages the readings over the weeks up to now into the hour of
+// the week they were taken in, local time
+func (power *Power) HourOfWeek(weeks int, now time.Time) (*Heatmap, error) {
+	readings, err := power.UsageBetween(now.AddDate(0, 0, -7*weeks), now)
+	if err != nil {
+		return nil, err
+	}
+	if len(readings) == 0 {
+		return nil, errors.New("no usage for the heatmap")
+	}
+	var sums Heatmap
+	var counts [7][24]int
+	seen := make(map[time.Time]bool)
+	for _, r := range readings {
+		local := r.Start.In(power.Location)
+		day := (int(local.Weekday()) + 6) % 7
+		sums[day][local.Hour()] += r.Amount
+		// readings shorter than an hour are added up before averaging, the
+		// hour repeated when the clocks go back counts twice
+		hour := r.Start.Truncate(time.Hour)
+		if !seen[hour] {
+			seen[hour] = true
+			counts[day][local.Hour()]++
+		}
+	}
+	heatmap := new(Heatmap)
+	for day := range sums {
+		for hour := range sums[day] {
+			if counts[day][hour] > 0 {
+				heatmap[day][hour] = sums[day][hour] / float64(counts[day][hour])
+			}
+		}
+	}
+	return heatmap, nil
+}
+
+// bayer is a 4x4 ordered dither matrix, a point is black when its entry is
+// below the shade wanted out of 16
+var bayer = [4][4]int{
+	{0, 8, 2, 10},
+	{12, 4, 14, 6},
+	{3, 11, 1, 9},
+	{15, 7, 13, 5},
+}
+
+// heatmapGraph draws the heatmap as a grid of dithered cells in the block
+// from left, top, darker where more is used. Days run down the side and
+// hours along the top
+func heatmapGraph(screen *Screen, heatmap *Heatmap, left, top, width, height int) {
+	max := 0.0
+	for day := range heatmap {
+		for hour := range heatmap[day] {
+			if heatmap[day][hour] > max {
+				max = heatmap[day][hour]
+			}
+		}
+	}
+
+	labelWidth, labelHeight := 30, 20
+	cellWidth := (width - labelWidth) / 24
+	cellHeight := (height - labelHeight) / 7
+	days := []string{"Mo", "Tu", "We", "Th", "Fr", "Sa", "Su"}
+	for day, label := range days {
+		y := top + labelHeight + day*cellHeight
+		screen.Write(label, left+labelWidth/2, y+cellHeight/2, true, false)
+	}
+	for hour := 0; hour < 24; hour += 6 {
+		x := left + labelWidth + hour*cellWidth
+		screen.Write(strconv.Itoa(hour), x+cellWidth/2, top+labelHeight/2, true, false)
+	}
+
+	for day := range heatmap {
+		for hour := range heatmap[day] {
+			shade := 0
+			if max > 0 {
+				shade = int(heatmap[day][hour] / max * 16)
+			}
+			x := left + labelWidth + hour*cellWidth
+			y := top + labelHeight + day*cellHeight
+			// a white gap is left between cells
+			screen.DrawPattern(x, y, x+cellWidth-1, y+cellHeight-1, func(x, y int) bool {
+				return bayer[y%4][x%4] < shade
+			})
+		}
+	}
+}
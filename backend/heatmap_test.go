@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHourOfWeek(t *testing.T) {
+	loc := copenhagen(t)
+	power := testPower(t, loc)
+	// the week from Monday 19 October, the clocks go back on the Sunday
+	start := time.Date(2026, 10, 19, 0, 0, 0, 0, loc)
+	now := time.Date(2026, 10, 26, 0, 0, 0, 0, loc)
+	if _, err := power.HourOfWeek(1, now); err == nil {
+		t.Error("no error without usage")
+	}
+
+	var readings []Reading
+	for s := start; s.Before(now); s = s.Add(time.Hour) {
+		local := s.In(loc)
+		switch {
+		case local.Weekday() == time.Wednesday && local.Hour() == 18:
+			readings = append(readings, Reading{Start: s, End: s.Add(time.Hour), Amount: 3})
+		case local.Weekday() == time.Tuesday && local.Hour() == 7:
+			// quarter hours are added up to the hour
+			for q := s; q.Before(s.Add(time.Hour)); q = q.Add(15 * time.Minute) {
+				readings = append(readings, Reading{Start: q, End: q.Add(15 * time.Minute), Amount: 0.5})
+			}
+		default:
+			readings = append(readings, Reading{Start: s, End: s.Add(time.Hour), Amount: 1})
+		}
+	}
+	if len(readings) != 7*24+1+3 {
+		t.Fatalf("stored %d readings for a week with a 25 hour day", len(readings))
+	}
+	if err := power.StoreUsage(readings); err != nil {
+		t.Fatal(err)
+	}
+	heatmap, err := power.HourOfWeek(1, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for day := range heatmap {
+		for hour, got := range heatmap[day] {
+			want := 1.0
+			switch {
+			case day == 2 && hour == 18:
+				want = 3
+			case day == 1 && hour == 7:
+				want = 2
+			}
+			// Sunday's two hours from 2 are averaged, not added up
+			if !near(got, want) {
+				t.Errorf("day %d hour %d is %.2f, want %.2f", day, hour, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,422 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const eloverblikURL = "https://api.eloverblik.dk/customerapi/api"
+
+// Eloverblik gets hourly meter readings from the Eloverblik customer API
+type Eloverblik struct {
+	BaseURL string
+	Client  *http.Client
+	// RefreshToken is the token generated on eloverblik.dk, it is exchanged
+	// for a data access token which lasts a day
+	RefreshToken string
+	// MeteringPoint is the meter to read, the first one on the account if empty
+	MeteringPoint string
+	// ExportPoint is the metering point for electricity fed into the grid,
+	// households with solar panels have one next to the consumption one
+	ExportPoint string
+
+	accessToken string
+	expires     time.Time
+}
+
+// Begin Eloverblik Data Struct
+type eloverblikToken struct {
+	Result string
+}
+
+type eloverblikMeteringPoints struct {
+	Result []struct {
+		MeteringPointID string `json:"meteringPointId"`
+	}
+}
+
+type eloverblikTimeSeries struct {
+	Result []struct {
+		Success        bool
+		ErrorText      string
+		MarketDocument struct {
+			TimeSeries []struct {
+				Period []struct {
+					Resolution   string
+					TimeInterval struct {
+						Start string
+						End   string
+					}
+					Point []struct {
+						Position string
+						Quantity string `json:"out_Quantity.quantity"`
+					}
+				}
+			}
+		} `json:"MyEnergyData_MarketDocument"`
+	}
+}
+
+// End Eloverblik Data Struct
+
+func NewEloverblik(config *Config) *Eloverblik {
+	return &Eloverblik{
+		BaseURL:       eloverblikURL,
+		Client:        http.DefaultClient,
+		RefreshToken:  config.EloverblikToken,
+		MeteringPoint: config.MeteringPoint,
+		ExportPoint:   config.ExportMeteringPoint,
+	}
+}
+
+// refresh gets a new data access token
+func (e *Eloverblik) refresh() error {
+	req, err := http.NewRequest(http.MethodGet, e.BaseURL+"/token", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+e.RefreshToken)
+	resp, err := e.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("eloverblik token: %s", resp.Status)
+	}
+	var token eloverblikToken
+	err = json.NewDecoder(resp.Body).Decode(&token)
+	if err != nil {
+		return fmt.Errorf("eloverblik token: %w", err)
+	}
+	e.accessToken = token.Result
+	// tokens last 24 hours, renew them a bit early
+	e.expires = time.Now().Add(23 * time.Hour)
+	return nil
+}
+
+// do sends a request with the data access token, getting a new token first
+// if it has expired or been rejected
+func (e *Eloverblik) do(method, path string, body []byte, result interface{}) error {
+	for attempt := 0; ; attempt++ {
+		if e.accessToken == "" || time.Now().After(e.expires) {
+			if err := e.refresh(); err != nil {
+				return err
+			}
+		}
+		req, err := http.NewRequest(method, e.BaseURL+path, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+e.accessToken)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := e.Client.Do(req)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode == http.StatusUnauthorized && attempt == 0 {
+			resp.Body.Close()
+			e.accessToken = ""
+			continue
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("eloverblik %s: %s", path, resp.Status)
+		}
+		err = json.NewDecoder(resp.Body).Decode(result)
+		if err != nil {
+			return fmt.Errorf("eloverblik %s: %w", path, err)
+		}
+		return nil
+	}
+}
+
+func (e *Eloverblik) meteringPoint() (string, error) {
+	if e.MeteringPoint != "" {
+		return e.MeteringPoint, nil
+	}
+	var points eloverblikMeteringPoints
+	err := e.do(http.MethodGet, "/meteringpoints/meteringpoints?includeAll=false", nil, &points)
+	if err != nil {
+		return "", err
+	}
+	if len(points.Result) == 0 {
+		return "", errors.New("eloverblik: no metering points on the account")
+	}
+	e.MeteringPoint = points.Result[0].MeteringPointID
+	return e.MeteringPoint, nil
+}
+
+// Readings returns the hourly readings for the days from until to
+func (e *Eloverblik) Readings(from, to time.Time) ([]Reading, error) {
+	point, err := e.meteringPoint()
+	if err != nil {
+		return nil, err
+	}
+	return e.readings(point, from, to)
+}
+
+// ExportReadings returns the hourly readings of the export metering point
+// for the days from until to, with the amounts in Exported
+func (e *Eloverblik) ExportReadings(from, to time.Time) ([]Reading, error) {
+	readings, err := e.readings(e.ExportPoint, from, to)
+	for i := range readings {
+		readings[i].Exported, readings[i].Amount = readings[i].Amount, 0
+	}
+	return readings, err
+}
+
+func (e *Eloverblik) readings(point string, from, to time.Time) ([]Reading, error) {
+	body, err := json.Marshal(map[string]map[string][]string{
+		"meteringPoints": {"meteringPoint": {point}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var series eloverblikTimeSeries
+	path := "/meterdata/gettimeseries/" + from.Format("2006-01-02") + "/" + to.Format("2006-01-02") + "/Hour"
+	err = e.do(http.MethodPost, path, body, &series)
+	if err != nil {
+		return nil, err
+	}
+
+	var readings []Reading
+	for _, result := range series.Result {
+		if !result.Success && result.ErrorText != "" {
+			return nil, fmt.Errorf("eloverblik: %s", result.ErrorText)
+		}
+		for _, ts := range result.MarketDocument.TimeSeries {
+			for _, period := range ts.Period {
+				start, err := time.Parse(time.RFC3339, period.TimeInterval.Start)
+				if err != nil {
+					return nil, fmt.Errorf("eloverblik: %w", err)
+				}
+				step := time.Hour
+				if period.Resolution == "PT15M" {
+					step = 15 * time.Minute
+				}
+				for _, point := range period.Point {
+					position, err := strconv.Atoi(point.Position)
+					if err != nil {
+						return nil, fmt.Errorf("eloverblik: %w", err)
+					}
+					amount, err := strconv.ParseFloat(point.Quantity, 64)
+					if err != nil {
+						return nil, fmt.Errorf("eloverblik: %w", err)
+					}
+					t := start.Add(time.Duration(position-1) * step)
+					readings = append(readings, Reading{Start: t, End: t.Add(step), Amount: amount})
+				}
+			}
+		}
+	}
+	return readings, nil
+}
+
+// ReadUsageCSV reads the semicolon separated export from eloverblik.dk,
+// with local times as "02-01-2006 15:04:05" and decimal commas
+func ReadUsageCSV(r io.Reader, loc *time.Location) ([]Reading, error) {
+	reader := csv.NewReader(r)
+	reader.Comma = ';'
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("usage csv: %w", err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))] = i
+	}
+	from, okFrom := columns["Fra dato"]
+	to, okTo := columns["Til dato"]
+	amount, okAmount := columns["Mængde"]
+	if !okFrom || !okTo || !okAmount {
+		return nil, errors.New("usage csv: missing Fra dato, Til dato or Mængde column")
+	}
+
+	var readings []Reading
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("usage csv: %w", err)
+		}
+		if len(record) <= from || len(record) <= to || len(record) <= amount {
+			return nil, fmt.Errorf("usage csv line %d: too few columns", line)
+		}
+		var reading Reading
+		reading.Start, err = time.ParseInLocation("02-01-2006 15:04:05", record[from], loc)
+		if err != nil {
+			return nil, fmt.Errorf("usage csv line %d: %w", line, err)
+		}
+		reading.End, err = time.ParseInLocation("02-01-2006 15:04:05", record[to], loc)
+		if err != nil {
+			return nil, fmt.Errorf("usage csv line %d: %w", line, err)
+		}
+		reading.Amount, err = strconv.ParseFloat(strings.Replace(record[amount], ",", ".", 1), 64)
+		if err != nil {
+			return nil, fmt.Errorf("usage csv line %d: %w", line, err)
+		}
+		readings = append(readings, reading)
+	}
+	return readings, nil
+}
+
+func readUsageFile(path string, loc *time.Location) ([]Reading, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	readings, err := ReadUsageCSV(file, loc)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return readings, nil
+}
+
+// ImportUsage loads readings into the useage table, from the CSV files given
+// as arguments or otherwise from Eloverblik since the last stored day. The
+// sub-meters with a metering point are imported from Eloverblik along with
+// the main one
+func ImportUsage(config *Config, power *Power) error {
+	var readings []Reading
+	if len(config.Args) > 0 {
+		for _, path := range config.Args {
+			r, err := readUsageFile(path, config.Location)
+			if err != nil {
+				return err
+			}
+			readings = append(readings, r...)
+		}
+		return power.StoreUsage(readings)
+	}
+
+	if config.EloverblikToken == "" {
+		return errors.New("no eloverblik token configured")
+	}
+	from, to := importPeriod(config, power)
+	eloverblik := NewEloverblik(config)
+	readings, err := eloverblik.Readings(from, to)
+	if err != nil {
+		return err
+	}
+	if eloverblik.ExportPoint != "" {
+		exports, err := eloverblik.ExportReadings(from, to)
+		if err != nil {
+			return err
+		}
+		readings = mergeExports(readings, exports)
+	}
+	if err = power.StoreUsage(readings); err != nil {
+		return err
+	}
+	for _, m := range config.SubMeters {
+		if m.MeteringPoint == "" {
+			continue
+		}
+		readings, err := eloverblik.readings(m.MeteringPoint, from, to)
+		if err != nil {
+			return fmt.Errorf("%s: %w", m.Name, err)
+		}
+		if err = power.StoreMeterUsage(m.Name, readings); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// importPeriod is the days to import from Eloverblik, the last 30 or since
+// the day before the last stored
+func importPeriod(config *Config, power *Power) (from, to time.Time) {
+	to = time.Now().In(config.Location)
+	from = to.AddDate(0, 0, -30)
+	if latest, err := power.mostRecentDay(); err == nil && latest.After(from) {
+		// go back a day in case the last one was incomplete
+		from = latest.AddDate(0, 0, -1)
+	}
+	return from, to
+}
+
+// ImportSubMeter loads a sub-meter's readings, named by the first argument,
+// from the CSV files given after it or otherwise from its metering point on
+// Eloverblik
+func ImportSubMeter(config *Config, power *Power) error {
+	if len(config.Args) == 0 {
+		return errors.New("no sub-meter given")
+	}
+	var meter *SubMeter
+	for i := range config.SubMeters {
+		if config.SubMeters[i].Name == config.Args[0] {
+			meter = &config.SubMeters[i]
+		}
+	}
+	if meter == nil {
+		return fmt.Errorf("unknown sub-meter %q", config.Args[0])
+	}
+	if files := config.Args[1:]; len(files) > 0 {
+		var readings []Reading
+		for _, path := range files {
+			r, err := readUsageFile(path, config.Location)
+			if err != nil {
+				return err
+			}
+			readings = append(readings, r...)
+		}
+		return power.StoreMeterUsage(meter.Name, readings)
+	}
+
+	if config.EloverblikToken == "" {
+		return errors.New("no eloverblik token configured")
+	}
+	if meter.MeteringPoint == "" {
+		return fmt.Errorf("sub-meter %s has no metering point", meter.Name)
+	}
+	from, to := importPeriod(config, power)
+	readings, err := NewEloverblik(config).readings(meter.MeteringPoint, from, to)
+	if err != nil {
+		return err
+	}
+	return power.StoreMeterUsage(meter.Name, readings)
+}
+
+// mergeExports sets the export of each reading from the export reading for
+// the same period
+func mergeExports(readings, exports []Reading) []Reading {
+	exported := make(map[time.Time]float64)
+	for _, r := range exports {
+		exported[r.Start.UTC()] = r.Exported
+	}
+	for i := range readings {
+		readings[i].Exported = exported[readings[i].Start.UTC()]
+	}
+	return readings
+}
+
+// ImportProduction loads the solar production readings in the CSV files
+// given as arguments into the production table
+func ImportProduction(config *Config, power *Power) error {
+	if len(config.Args) == 0 {
+		return errors.New("no production files given")
+	}
+	var readings []Reading
+	for _, path := range config.Args {
+		r, err := readUsageFile(path, config.Location)
+		if err != nil {
+			return err
+		}
+		readings = append(readings, r...)
+	}
+	return power.StoreProduction(readings)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// eloverblikServer stands in for the customer API. Data access tokens are
+// handed out as access-1, access-2 and so on, and rejected reports whether
+// one is refused as expired
+func eloverblikServer(t *testing.T, rejected func(token string) bool) (*httptest.Server, *int) {
+	t.Helper()
+	series, err := ioutil.ReadFile("testdata/eloverblik-timeseries.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		switch {
+		case r.URL.Path == "/token":
+			if auth != "Bearer refresh-token" {
+				http.Error(w, "bad refresh token", http.StatusUnauthorized)
+				return
+			}
+			tokens++
+			fmt.Fprintf(w, `{"result": "access-%d"}`, tokens)
+		case rejected(strings.TrimPrefix(auth, "Bearer ")):
+			http.Error(w, "token expired", http.StatusUnauthorized)
+		case r.URL.Path == "/meteringpoints/meteringpoints":
+			w.Write([]byte(`{"result": [{"meteringPointId": "571313100000000000"}, {"meteringPointId": "571313100000000001"}]}`))
+		case r.URL.Path == "/meterdata/gettimeseries/2026-01-17/2026-01-19/Hour" && r.Method == http.MethodPost:
+			body, _ := ioutil.ReadAll(r.Body)
+			if !strings.Contains(string(body), `"571313100000000000"`) {
+				http.Error(w, "unknown metering point", http.StatusBadRequest)
+				return
+			}
+			w.Write(series)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &tokens
+}
+
+func TestEloverblikReadings(t *testing.T) {
+	server, tokens := eloverblikServer(t, func(string) bool { return false })
+	e := &Eloverblik{BaseURL: server.URL, Client: server.Client(), RefreshToken: "refresh-token"}
+	readings, err := e.Readings(time.Date(2026, 1, 17, 0, 0, 0, 0, time.UTC), time.Date(2026, 1, 19, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.MeteringPoint != "571313100000000000" || *tokens != 1 {
+		t.Errorf("read %s with %d tokens", e.MeteringPoint, *tokens)
+	}
+	at := func(day, hour, min int) time.Time {
+		return time.Date(2026, 1, day, hour, min, 0, 0, time.UTC)
+	}
+	want := []Reading{
+		{Start: at(16, 23, 0), End: at(17, 0, 0), Amount: 0.412},
+		{Start: at(17, 0, 0), End: at(17, 1, 0), Amount: 0.388},
+		{Start: at(17, 1, 0), End: at(17, 2, 0), Amount: 1.25},
+		{Start: at(17, 23, 0), End: at(17, 23, 15), Amount: 0.1},
+		{Start: at(17, 23, 15), End: at(17, 23, 30), Amount: 0.125},
+	}
+	checkReadings(t, readings, want)
+}
+
+func TestEloverblikRefreshOnUnauthorized(t *testing.T) {
+	// the first token is refused, as when it expired early
+	server, tokens := eloverblikServer(t, func(token string) bool { return token == "access-1" })
+	e := &Eloverblik{BaseURL: server.URL, Client: server.Client(), RefreshToken: "refresh-token", MeteringPoint: "571313100000000000"}
+	readings, err := e.Readings(time.Date(2026, 1, 17, 0, 0, 0, 0, time.UTC), time.Date(2026, 1, 19, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *tokens != 2 || e.accessToken != "access-2" {
+		t.Errorf("got %d tokens, using %q", *tokens, e.accessToken)
+	}
+	if len(readings) != 5 {
+		t.Errorf("got %d readings after the retry", len(readings))
+	}
+
+	// it is only retried once
+	server, tokens = eloverblikServer(t, func(string) bool { return true })
+	e = &Eloverblik{BaseURL: server.URL, Client: server.Client(), RefreshToken: "refresh-token"}
+	if _, err = e.meteringPoint(); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("got %v, want a 401 error", err)
+	}
+	if *tokens != 2 {
+		t.Errorf("got %d tokens, want 2", *tokens)
+	}
+
+	e = &Eloverblik{BaseURL: server.URL, Client: server.Client(), RefreshToken: "wrong"}
+	if _, err = e.meteringPoint(); err == nil || !strings.Contains(err.Error(), "eloverblik token") {
+		t.Errorf("got %v for a wrong refresh token", err)
+	}
+}
+
+// checkReadings compares readings with want, with the times in any zone
+func checkReadings(t *testing.T, got, want []Reading) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d readings, want %d: %v", len(got), len(want), got)
+	}
+	for i := range want {
+		if !got[i].Start.Equal(want[i].Start) || !got[i].End.Equal(want[i].End) ||
+			!near(got[i].Amount, want[i].Amount) || !near(got[i].Exported, want[i].Exported) {
+			t.Errorf("%d: got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestReadUsageCSV(t *testing.T) {
+	loc := copenhagen(t)
+	at := func(hour int) time.Time {
+		return time.Date(2026, 1, 17, hour, 0, 0, 0, loc)
+	}
+	want := []Reading{
+		{Start: at(0), End: at(1), Amount: 0.412},
+		{Start: at(1), End: at(2), Amount: 0.388},
+		{Start: at(2), End: at(3), Amount: 1.25},
+	}
+	f, err := os.Open("testdata/usage.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	readings, err := ReadUsageCSV(f, loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkReadings(t, readings, want)
+
+	// the byte order mark is on the column that is needed
+	readings, err = ReadUsageCSV(strings.NewReader("\ufeffFra dato;Til dato;Mængde\n17-01-2026 00:00:00;17-01-2026 01:00:00;0,412\n"), loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkReadings(t, readings, want[:1])
+
+	for _, csv := range []string{
+		"Fra dato;Til dato\n",
+		"Fra dato;Til dato;Mængde\n17-01-2026 00:00:00;17-01-2026 01:00:00;0.412.5\n",
+		"Fra dato;Til dato;Mængde\n2026-01-17 00:00;17-01-2026 01:00:00;0,412\n",
+	} {
+		if _, err = ReadUsageCSV(strings.NewReader(csv), loc); err == nil {
+			t.Errorf("no error reading %q", csv)
+		}
+	}
+}
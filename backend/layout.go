@@ -0,0 +1,295 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"io/ioutil"
+	"log"
+	"time"
+)
+
+// Layout describes the panels drawn on the display and where they go
+type Layout struct {
+	Width  int
+	Height int
+	Panels []*Panel
+}
+
+// Panel is a single block on the display. X and Y are the top left corner
+// of the panel, everything inside it is drawn relative to that point. For
+// text, date and timestamp panels X and Y are the centre of the text
+type Panel struct {
+	Type   string
+	X      int
+	Y      int
+	Width  int
+	Height int
+	// Source selects what data the panel shows, e.g. "week" for a usage panel,
+	// "temp" for a weather panel or "hourly" for a cost graph of hourly averages
+	Source string
+	// Style is panel specific, e.g. "black"/"white" for rects and text or
+	// "box"/"underline" for weather panels
+	Style string
+	Text  string
+	Large bool
+	// Window is how long a run of cheap prices to look for, e.g. "3h", for
+	// cheapest-window panels. A cost graph highlights it when set
+	Window string
+	// Length is Window once parsed, set by LoadLayout
+	Length time.Duration `json:"-"`
+	// Hours makes a cheapest-window panel show that many of the cheapest
+	// hours, wherever they are, rather than a run
+	Hours int
+	// Weeks is how many weeks a heatmap averages over, 4 when not set
+	Weeks int
+	// Days is how many days a meters panel shows, 7 when not set
+	Days int
+	// Meter is the sub-meter, or remainder, a usage or co2 panel shows
+	// instead of the main meter
+	Meter string
+}
+
+// LoadLayout reads a JSON layout file, the panels can show the main meter,
+// the remainder or one of subMeters
+func LoadLayout(path string, subMeters []string) (*Layout, error) {
+	file, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	layout := new(Layout)
+	err = json.Unmarshal(file, layout)
+	if err != nil {
+		return nil, fmt.Errorf("parsing layout %s: %w", path, err)
+	}
+	meters := map[string]bool{MainMeter: true, RemainderMeter: true}
+	for _, m := range subMeters {
+		meters[m] = true
+	}
+	for i, p := range layout.Panels {
+		if _, ok := panelRenderers[p.Type]; !ok {
+			return nil, fmt.Errorf("layout %s: panel %d has unknown type %q", path, i, p.Type)
+		}
+		if p.Meter != "" && !meters[p.Meter] {
+			return nil, fmt.Errorf("layout %s: panel %d has unknown meter %q", path, i, p.Meter)
+		}
+		if p.Window != "" {
+			p.Length, err = time.ParseDuration(p.Window)
+			if err != nil || p.Length <= 0 {
+				return nil, fmt.Errorf("layout %s: panel %d has bad window %q", path, i, p.Window)
+			}
+		}
+		if p.Hours < 0 {
+			return nil, fmt.Errorf("layout %s: panel %d has %d hours", path, i, p.Hours)
+		}
+	}
+	return layout, nil
+}
+
+// Sources of the data shown on the panels, each can be reloaded separately
+const (
+	ClockSource   = "clock"
+	WeatherSource = "weather"
+	PriceSource   = "prices"
+	UsageSource   = "usage"
+)
+
+// Sources is every data source
+var Sources = []string{ClockSource, WeatherSource, PriceSource, UsageSource}
+
+// Renderer draws a layout onto a screen using the data last loaded from
+// each source. Weather is nil if the weather service has never been
+// contacted successfully
+type Renderer struct {
+	Screen    *Screen
+	Power     *Power
+	Weather   *Weather
+	Provider  WeatherProvider
+	Latitude  string
+	Longitude string
+	// Meter is the meter's HAN port when it is being read
+	Meter *Meter
+	// Budget is the monthly budget in DKK, 0 for none
+	Budget float64
+
+	currentCost int
+	prices      []PriceInterval
+	priceStart  time.Time
+	levels      *PriceLevels
+	emissions   []Emission
+	usage       map[string]Useage
+	summaries   map[string]Comparison
+	budget      Budget
+	// heatmaps are by the number of weeks, worked out when first drawn
+	heatmaps map[int]*Heatmap
+	// shifting is the stored shifting history by the number of weeks, read
+	// when first drawn
+	shifting map[int][]Shifting
+	// meterDays are the meters' use by the number of days, read when first
+	// drawn
+	meterDays map[int][]MeterDay
+	// errs holds why each item failed to load, by source or usage period
+	errs map[string]error
+}
+
+// Load refreshes the data for a source. If the weather cannot be fetched
+// the last forecast is kept, otherwise the panels using data that failed
+// to load show an error instead
+func (r *Renderer) Load(source string) error {
+	if r.errs == nil {
+		r.errs = make(map[string]error)
+	}
+	var err error
+	switch source {
+	case WeatherSource:
+		w := NewWeather(r.Latitude, r.Longitude, r.Provider)
+		if w == nil {
+			err = errors.New("cannot contact weather service")
+		} else {
+			r.Weather = w
+		}
+	case PriceSource:
+		var costErr error
+		r.currentCost, costErr = r.Power.CurrentCost()
+		r.errs["current-cost"] = costErr
+		r.prices, r.priceStart, err = r.Power.CostData(time.Now())
+		levels, levelErr := r.Power.PriceLevels(time.Now())
+		r.levels = &levels
+		if levelErr != nil {
+			// the bars are drawn without levels
+			log.Println("price levels:", levelErr)
+			r.levels = nil
+		}
+		if err == nil {
+			err = costErr
+		}
+		var emissionErr error
+		r.emissions, emissionErr = r.Power.EmissionsBetween(r.priceStart, r.priceStart.AddDate(0, 0, 2))
+		if emissionErr != nil {
+			// the graph is drawn without them
+			log.Println("CO2 emissions:", emissionErr)
+		}
+	case UsageSource:
+		r.usage = make(map[string]Useage)
+		loaders := map[string]func(string) (Useage, error){
+			"week":    r.Power.MeterWeekUseage,
+			"prevday": r.Power.MeterPrevDayUseage,
+			"day":     r.Power.MeterDayUseage,
+		}
+		meters := append([]string{MainMeter}, r.Power.Meters()...)
+		for period, load := range loaders {
+			for _, meter := range meters {
+				usage, loadErr := load(meter)
+				key := usageKey(meter, period)
+				r.usage[key] = usage
+				r.errs[key] = loadErr
+				// the sub-meters only fail their own panels
+				if meter == MainMeter && err == nil {
+					err = loadErr
+				}
+			}
+		}
+		r.heatmaps = make(map[int]*Heatmap)
+		r.shifting = make(map[int][]Shifting)
+		r.meterDays = make(map[int][]MeterDay)
+		r.summaries = make(map[string]Comparison)
+		for _, period := range Periods {
+			comparison, loadErr := r.Power.Compare(period, time.Now())
+			r.summaries[period] = comparison
+			// summaries often cannot be compared yet on a new install, so
+			// only their own panels show it
+			r.errs["summary-"+period] = loadErr
+		}
+		if r.Budget > 0 {
+			var budgetErr error
+			r.budget, budgetErr = r.Power.Budget(r.Budget, time.Now())
+			r.errs["budget"] = budgetErr
+		}
+	}
+	r.errs[source] = err
+	if err != nil {
+		return fmt.Errorf("loading %s: %w", source, err)
+	}
+	return nil
+}
+
+// usageKey is what a meter's usage over a period is kept under, the main
+// meter's just by the period
+func usageKey(meter, period string) string {
+	if meter == "" || meter == MainMeter {
+		return period
+	}
+	return meter + "/" + period
+}
+
+// panelError is drawn in place of a panel whose data could not be loaded
+func (r *Renderer) panelError(p *Panel, message string) {
+	r.rect(p, 0, 0, p.Width, p.Height, image.White)
+	r.write(p, message, p.Width/2, p.Height/2, true, false)
+}
+
+type panelRenderer func(r *Renderer, p *Panel)
+
+var panelRenderers = map[string]panelRenderer{
+	"rect":            rectPanel,
+	"line":            linePanel,
+	"text":            textPanel,
+	"date":            datePanel,
+	"timestamp":       timestampPanel,
+	"sun":             sunPanel,
+	"current-cost":    currentCostPanel,
+	"live":            livePanel,
+	"cost-graph":      costGraphPanel,
+	"cheapest-window": cheapestPanel,
+	"usage":           usagePanel,
+	"co2":             co2Panel,
+	"summary":         summaryPanel,
+	"budget":          budgetPanel,
+	"heatmap":         heatmapPanel,
+	"shifting":        shiftingPanel,
+	"meters":          metersPanel,
+	"weather":         weatherPanel,
+	"forecast":        forecastPanel,
+	"weather-graph":   weatherGraphPanel,
+}
+
+// Render draws every panel in the layout, in order
+func (r *Renderer) Render(layout *Layout) {
+	for _, p := range layout.Panels {
+		panelRenderers[p.Type](r, p)
+	}
+}
+
+func (p *Panel) colour() *image.Uniform {
+	if p.Style == "white" {
+		return image.White
+	}
+	return image.Black
+}
+
+// write is Screen.Write relative to the panel's corner
+func (r *Renderer) write(p *Panel, text string, x, y int, black, large bool) {
+	r.Screen.Write(text, p.X+x, p.Y+y, black, large)
+}
+
+// rect is Screen.DrawRect relative to the panel's corner
+func (r *Renderer) rect(p *Panel, x1, y1, x2, y2 int, colour *image.Uniform) {
+	r.Screen.DrawRect(p.X+x1, p.Y+y1, p.X+x2, p.Y+y2, colour)
+}
+
+func rectPanel(r *Renderer, p *Panel) {
+	r.rect(p, 0, 0, p.Width, p.Height, p.colour())
+}
+
+func linePanel(r *Renderer, p *Panel) {
+	if p.Width == 0 {
+		r.Screen.DrawVerticalLine(p.X, p.Y, p.Height)
+		return
+	}
+	r.Screen.DrawHorizontalLine(p.Y, p.X, p.Width)
+}
+
+func textPanel(r *Renderer, p *Panel) {
+	r.Screen.Write(p.Text, p.X, p.Y, p.Style != "white", p.Large)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadLayout(t *testing.T) {
+	layout, err := LoadLayout("layout.json", nil)
+	if err != nil {
+		t.Fatalf("the layout shipped does not load: %v", err)
+	}
+	if layout.Width != 800 || layout.Height != 480 {
+		t.Errorf("layout is %dx%d", layout.Width, layout.Height)
+	}
+
+	tests := []struct {
+		name  string
+		panel string
+		err   string
+	}{
+		{"window", `{"type": "cheapest-window", "window": "90m"}`, ""},
+		{"hours", `{"type": "cheapest-window", "hours": 4}`, ""},
+		{"unknown type", `{"type": "clock"}`, "unknown type"},
+		{"bad window", `{"type": "cost-graph", "window": "3 hours"}`, "bad window"},
+		{"no window", `{"type": "cheapest-window", "window": "0s"}`, "bad window"},
+		{"negative hours", `{"type": "cheapest-window", "hours": -2}`, "-2 hours"},
+		{"sub-meter", `{"type": "usage", "meter": "heat pump"}`, ""},
+		{"remainder", `{"type": "usage", "meter": "remainder"}`, ""},
+		{"main meter", `{"type": "co2", "meter": "main"}`, ""},
+		{"unknown meter", `{"type": "usage", "meter": "heatpump"}`, "unknown meter \"heatpump\""},
+	}
+	dir := t.TempDir()
+	for _, test := range tests {
+		path := filepath.Join(dir, "layout.json")
+		err := ioutil.WriteFile(path, []byte(`{"width": 800, "height": 480, "panels": [`+test.panel+`]}`), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		layout, err := LoadLayout(path, []string{"heat pump"})
+		switch {
+		case test.err == "" && err != nil:
+			t.Errorf("%s: %v", test.name, err)
+		case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+			t.Errorf("%s: got %v, want an error about %s", test.name, err, test.err)
+		case test.name == "window" && layout.Panels[0].Length != 90*time.Minute:
+			t.Errorf("window is %s long, want 90m", layout.Panels[0].Length)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Level is how a price compares with what is normal
+type Level int
+
+const (
+	VeryCheap Level = iota
+	Cheap
+	Normal
+	Expensive
+	VeryExpensive
+)
+
+func (l Level) String() string {
+	switch l {
+	case VeryCheap:
+		return "very cheap"
+	case Cheap:
+		return "cheap"
+	case Expensive:
+		return "expensive"
+	case VeryExpensive:
+		return "very expensive"
+	}
+	return "normal"
+}
+
+// PriceLevels are the prices in øre/kWh where each level ends and the next
+// one starts, from very cheap up to very expensive
+type PriceLevels [4]float64
+
+// Level classifies a price in øre/kWh
+func (l PriceLevels) Level(price float64) Level {
+	level := VeryCheap
+	for _, limit := range l {
+		if price < limit {
+			break
+		}
+		level++
+	}
+	return level
+}
+
+// levelPercentiles split the last week's prices into the five levels, so
+// the cheapest tenth are very cheap and so on
+var levelPercentiles = PriceLevels{10, 30, 70, 90}
+
+// PriceLevels returns the limits between the price levels. These are the
+// configured thresholds if there are any, otherwise percentiles of the
+// prices paid over the week up to now
+func (power *Power) PriceLevels(now time.Time) (PriceLevels, error) {
+	if len(power.Thresholds) == len(PriceLevels{}) {
+		var levels PriceLevels
+		copy(levels[:], power.Thresholds)
+		return levels, nil
+	}
+	prices, err := power.PricesBetween(now.AddDate(0, 0, -7), now)
+	if err != nil {
+		return PriceLevels{}, err
+	}
+	if len(prices) == 0 {
+		return PriceLevels{}, fmt.Errorf("%w in the last week", ErrNoPrice)
+	}
+	prices = power.consumerPrices(prices)
+	values := make([]float64, len(prices))
+	for i, p := range prices {
+		values[i] = p.Price * 100
+	}
+	sort.Float64s(values)
+	var levels PriceLevels
+	for i, percentile := range levelPercentiles {
+		index := int(math.Round(percentile / 100 * float64(len(values)-1)))
+		levels[i] = values[index]
+	}
+	return levels, nil
+}
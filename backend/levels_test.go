@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLevel(t *testing.T) {
+	levels := PriceLevels{50, 100, 200, 300}
+	tests := []struct {
+		price float64
+		want  Level
+	}{
+		{-10, VeryCheap},
+		{49.9, VeryCheap},
+		// a limit is where the next level starts
+		{50, Cheap},
+		{99, Cheap},
+		{100, Normal},
+		{199, Normal},
+		{200, Expensive},
+		{300, VeryExpensive},
+		{1000, VeryExpensive},
+	}
+	for _, test := range tests {
+		if got := levels.Level(test.price); got != test.want {
+			t.Errorf("%.1f øre is %s, want %s", test.price, got, test.want)
+		}
+	}
+}
+
+func TestPriceLevels(t *testing.T) {
+	power := testPower(t, time.UTC)
+	now := time.Date(2026, 1, 18, 12, 0, 0, 0, time.UTC)
+	if _, err := power.PriceLevels(now); !errors.Is(err, ErrNoPrice) {
+		t.Errorf("got %v without prices, want ErrNoPrice", err)
+	}
+
+	// the week's hours cost 0 to 167 øre, and tomorrow's are not counted
+	var prices []PriceInterval
+	start := now.AddDate(0, 0, -7)
+	for i := 0; i < 24*8; i++ {
+		s := start.Add(time.Duration(i) * time.Hour)
+		prices = append(prices, PriceInterval{Start: s, End: s.Add(time.Hour), Price: float64(i) / 100})
+	}
+	if err := power.StorePrices(prices); err != nil {
+		t.Fatal(err)
+	}
+	power.Model = &PriceModel{VAT: 25}
+	levels, err := power.PriceLevels(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the percentiles are taken of what is paid, VAT included
+	want := PriceLevels{17 * 1.25, 50 * 1.25, 117 * 1.25, 150 * 1.25}
+	for i := range want {
+		if !near(levels[i], want[i]) {
+			t.Errorf("got levels %v, want %v", levels, want)
+			break
+		}
+	}
+
+	// thresholds are used as they are
+	power.Thresholds = []float64{50, 100, 200, 300}
+	levels, err = power.PriceLevels(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if levels != (PriceLevels{50, 100, 200, 300}) {
+		t.Errorf("got levels %v with thresholds", levels)
+	}
+}
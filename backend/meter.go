@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"agurk.org/display/backend/han"
+)
+
+// staleReading is how old the meter's last message can be before the live
+// panel stops showing it, the meter pushes every 10 seconds
+const staleReading = time.Minute
+
+// Meter reads the smart meter's HAN port, keeping the latest measurement for
+// the display and storing the usage of each hour as it ends, unless usage
+// from Eloverblik is already stored for it
+type Meter struct {
+	power  *Power
+	port   io.ReadCloser
+	reader *han.Reader
+
+	mu     sync.Mutex
+	latest *han.Measurement
+
+	// energy is the last message with the meter readings, once there has
+	// been one the hours are taken from the readings rather than the power
+	energy *han.Measurement
+	// previous is the last message, hour is the hour being added up from
+	// the power and used and exported the kWh in it so far. An hour is only
+	// stored when the messages cover all of it
+	previous *han.Measurement
+	hour     time.Time
+	used     float64
+	exported float64
+	complete bool
+}
+
+// OpenMeter opens the serial device in config for reading the meter
+func OpenMeter(config *Config, power *Power) (*Meter, error) {
+	port, err := han.OpenSerial(config.HANDevice, config.HANBaud)
+	if err != nil {
+		return nil, err
+	}
+	reader := han.NewReader(port)
+	reader.Key = config.HANCipherKey
+	reader.AuthKey = config.HANAuthenticationKey
+	reader.EnergyUnit = config.HANEnergyUnit
+	return &Meter{power: power, port: port, reader: reader}, nil
+}
+
+// Run reads messages until the port is closed or fails. Messages that cannot
+// be read are logged and skipped
+func (m *Meter) Run() error {
+	for {
+		measurement, err := m.reader.Next()
+		if portFailed(err) {
+			return err
+		}
+		if err != nil {
+			log.Println("reading meter:", err)
+			continue
+		}
+		m.mu.Lock()
+		m.latest = measurement
+		m.mu.Unlock()
+		if reading := m.add(measurement); reading != nil {
+			if err := m.power.StoreMissingUsage([]Reading{*reading}); err != nil {
+				log.Println("storing meter usage:", err)
+			}
+		}
+	}
+}
+
+// Latest returns the last measurement, or nil when there has not been one
+// for a while
+func (m *Meter) Latest() *han.Measurement {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.latest == nil || time.Since(m.latest.Time) > staleReading {
+		return nil
+	}
+	return m.latest
+}
+
+// Close closes the port, which stops Run
+func (m *Meter) Close() error {
+	return m.port.Close()
+}
+
+// add counts a measurement towards the hour it was taken in, returning the
+// reading for an hour once it has ended
+func (m *Meter) add(measurement *han.Measurement) *Reading {
+	hour := measurement.Time.Truncate(time.Hour)
+	if measurement.HasEnergy {
+		// the readings are sent just after the hour, so the difference from
+		// the last ones is what was used in the hours between
+		last := m.energy
+		m.energy = measurement
+		if last == nil {
+			return nil
+		}
+		start := last.Time.Truncate(time.Hour)
+		if !hour.After(start) || measurement.ImportEnergy < last.ImportEnergy {
+			return nil
+		}
+		return &Reading{
+			Start:    start,
+			End:      hour,
+			Amount:   measurement.ImportEnergy - last.ImportEnergy,
+			Exported: math.Max(measurement.ExportEnergy-last.ExportEnergy, 0),
+		}
+	}
+
+	previous := m.previous
+	m.previous = measurement
+	if m.energy != nil {
+		return nil
+	}
+	if previous == nil {
+		m.hour = hour
+		return nil
+	}
+	var reading *Reading
+	gap := measurement.Time.Sub(previous.Time)
+	if !hour.Equal(m.hour) {
+		// the power at the end of the hour is counted up until the hour
+		m.count(previous, hour.Sub(previous.Time))
+		if m.complete && gap <= staleReading {
+			reading = &Reading{Start: m.hour, End: m.hour.Add(time.Hour), Amount: m.used, Exported: m.exported}
+		}
+		m.hour = hour
+		m.used, m.exported = 0, 0
+		m.count(previous, measurement.Time.Sub(hour))
+		m.complete = gap <= staleReading
+		return reading
+	}
+	m.count(previous, gap)
+	if gap > staleReading {
+		m.complete = false
+	}
+	return nil
+}
+
+// count adds the energy used and exported at a measurement's power over a
+// length of time
+func (m *Meter) count(measurement *han.Measurement, length time.Duration) {
+	m.used += measurement.Import * length.Hours() / 1000
+	m.exported += measurement.Export * length.Hours() / 1000
+}
+
+// portFailed is whether an error is from the port rather than a message
+func portFailed(err error) bool {
+	var pathErr *os.PathError
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.As(err, &pathErr)
+}
+
+// ReadMeter prints the meter's messages as they come in. Nothing is stored,
+// the hours are only added up and stored by the daemon
+func ReadMeter(config *Config, power *Power) error {
+	if config.HANDevice == "" {
+		return errors.New("no HAN device configured")
+	}
+	meter, err := OpenMeter(config, power)
+	if err != nil {
+		return err
+	}
+	defer meter.Close()
+	for {
+		m, err := meter.reader.Next()
+		if portFailed(err) {
+			return err
+		}
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		log.Printf("import %.0f W, export %.0f W", m.Import, m.Export)
+		if m.HasEnergy {
+			log.Printf("meter readings: import %.2f kWh, export %.2f kWh", m.ImportEnergy, m.ExportEnergy)
+		}
+	}
+}
+
+// parseKey decodes a hex key from the grid company, spaces are allowed
+func parseKey(name, key string) ([]byte, error) {
+	if key == "" {
+		return nil, nil
+	}
+	b, err := hex.DecodeString(strings.ReplaceAll(key, " ", ""))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) != 16 {
+		return nil, errors.New(name + " must be 16 bytes")
+	}
+	return b, nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"agurk.org/display/backend/han"
+)
+
+// pushPower adds power messages every 10 seconds from start until end, the
+// readings for hours that ended are returned. The power is counted until the
+// next message
+func pushPower(m *Meter, start, end time.Time, watts float64) []Reading {
+	var readings []Reading
+	for t := start; t.Before(end); t = t.Add(10 * time.Second) {
+		if r := m.add(&han.Measurement{Time: t, Import: watts, Export: watts / 4}); r != nil {
+			readings = append(readings, *r)
+		}
+	}
+	return readings
+}
+
+func TestMeterHoursFromPower(t *testing.T) {
+	at := func(hour, min int) time.Time {
+		return time.Date(2026, 1, 18, hour, min, 0, 0, time.UTC)
+	}
+	m := new(Meter)
+	// the hour it starts in is not all covered
+	readings := pushPower(m, at(9, 30), at(10, 0), 500)
+	if len(readings) != 0 {
+		t.Errorf("got %v for a partly covered hour", readings)
+	}
+	readings = pushPower(m, at(10, 0), at(11, 0).Add(time.Second), 1000)
+	if len(readings) != 1 {
+		t.Fatalf("got %v, want the hour from 10", readings)
+	}
+	r := readings[0]
+	if !r.Start.Equal(at(10, 0)) || !r.End.Equal(at(11, 0)) || !near(r.Amount, 1) || !near(r.Exported, 0.25) {
+		t.Errorf("got %+v, want 1 kWh used and 0.25 exported from 10 to 11", r)
+	}
+
+	// the messages stop for two minutes, so the hour is not stored
+	readings = pushPower(m, at(11, 0).Add(10*time.Second), at(11, 30), 1000)
+	readings = append(readings, pushPower(m, at(11, 32), at(12, 0), 1000)...)
+	if len(readings) != 0 {
+		t.Errorf("got %v for an hour with a gap", readings)
+	}
+	readings = pushPower(m, at(12, 0), at(13, 0).Add(time.Second), 2000)
+	if len(readings) != 1 || !readings[0].Start.Equal(at(12, 0)) || !near(readings[0].Amount, 2) {
+		t.Errorf("got %v, want 2 kWh from 12", readings)
+	}
+}
+
+func TestMeterHoursFromRegisters(t *testing.T) {
+	at := func(hour int) time.Time {
+		// the registers are sent a few seconds after the hour
+		return time.Date(2026, 1, 18, hour, 0, 5, 0, time.UTC)
+	}
+	hour := func(h int) time.Time {
+		return time.Date(2026, 1, 18, h, 0, 0, 0, time.UTC)
+	}
+	registers := func(t time.Time, imported, exported float64) *han.Measurement {
+		return &han.Measurement{Time: t, Import: 800, HasEnergy: true, ImportEnergy: imported, ExportEnergy: exported}
+	}
+	m := new(Meter)
+	if r := m.add(registers(at(10), 100, 20)); r != nil {
+		t.Errorf("got %+v from the first registers", r)
+	}
+	// the power in between is no longer added up
+	if readings := pushPower(m, at(10).Add(10*time.Second), at(11), 1000); len(readings) != 0 {
+		t.Errorf("got %v from the power", readings)
+	}
+
+	tests := []struct {
+		registers *han.Measurement
+		want      *Reading
+	}{
+		{registers(at(11), 101.5, 20.25), &Reading{Start: hour(10), End: hour(11), Amount: 1.5, Exported: 0.25}},
+		// a missed message covers both hours
+		{registers(at(13), 104, 20.25), &Reading{Start: hour(11), End: hour(13), Amount: 2.5}},
+		// the same hour again
+		{registers(at(13).Add(time.Minute), 104.1, 20.25), nil},
+		// a replaced meter starts from zero
+		{registers(at(14), 0.5, 0), nil},
+		{registers(at(15), 1, 0), &Reading{Start: hour(14), End: hour(15), Amount: 0.5}},
+	}
+	for i, test := range tests {
+		r := m.add(test.registers)
+		switch {
+		case test.want == nil && r != nil:
+			t.Errorf("%d: got %+v, want nothing", i, r)
+		case test.want != nil && r == nil:
+			t.Errorf("%d: got nothing, want %+v", i, test.want)
+		case test.want != nil && (!r.Start.Equal(test.want.Start) || !r.End.Equal(test.want.End) ||
+			!near(r.Amount, test.want.Amount) || !near(r.Exported, test.want.Exported)):
+			t.Errorf("%d: got %+v, want %+v", i, r, test.want)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Notifier sends a notification somewhere it will be seen
+type Notifier interface {
+	Notify(title, message string) error
+}
+
+// Ntfy posts notifications to a topic on an ntfy server, e.g.
+// https://ntfy.sh/my-topic
+type Ntfy struct {
+	URL    string
+	Client *http.Client
+	// Token is an access token for protected topics
+	Token string
+}
+
+func (n *Ntfy) Notify(title, message string) error {
+	req, err := http.NewRequest(http.MethodPost, n.URL, strings.NewReader(message))
+	if err != nil {
+		return err
+	}
+	// headers are ASCII, ntfy decodes encoded words
+	req.Header.Set("Title", mime.QEncoding.Encode("utf-8", title))
+	if n.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.Token)
+	}
+	return send(n.Client, req, "ntfy")
+}
+
+// Gotify posts notifications to a Gotify server with an application token
+type Gotify struct {
+	URL    string
+	Client *http.Client
+	Token  string
+}
+
+func (g *Gotify) Notify(title, message string) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"title":    title,
+		"message":  message,
+		"priority": 5,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(g.URL, "/")+"/message", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Gotify-Key", g.Token)
+	return send(g.Client, req, "gotify")
+}
+
+func send(client *http.Client, req *http.Request, service string) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s: %s", service, resp.Status)
+	}
+	return nil
+}
+
+// Mail sends notifications by email through an SMTP server
+type Mail struct {
+	// Server is host:port
+	Server string
+	From   string
+	To     []string
+	// Username and Password log in to the server when set
+	Username string
+	Password string
+}
+
+func (m *Mail) Notify(title, message string) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		host := m.Server
+		if i := strings.LastIndex(host, ":"); i >= 0 {
+			host = host[:i]
+		}
+		auth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", m.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(m.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", title))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(message, "\n", "\r\n"))
+	msg.WriteString("\r\n")
+	return smtp.SendMail(m.Server, auth, m.From, m.To, msg.Bytes())
+}
+
+// NewNotifiers returns the notifiers set up in config, none if no service
+// or mail server is configured
+func NewNotifiers(config *Config) ([]Notifier, error) {
+	var notifiers []Notifier
+	switch config.NotifyService {
+	case "":
+	case "ntfy":
+		notifiers = append(notifiers, &Ntfy{URL: config.NotifyURL, Client: http.DefaultClient, Token: config.NotifyToken})
+	case "gotify":
+		notifiers = append(notifiers, &Gotify{URL: config.NotifyURL, Client: http.DefaultClient, Token: config.NotifyToken})
+	default:
+		return nil, fmt.Errorf("unknown notification service %q", config.NotifyService)
+	}
+	if config.SMTPServer != "" {
+		var to []string
+		for _, address := range strings.Split(config.MailTo, ",") {
+			if address = strings.TrimSpace(address); address != "" {
+				to = append(to, address)
+			}
+		}
+		notifiers = append(notifiers, &Mail{
+			Server:   config.SMTPServer,
+			From:     config.MailFrom,
+			To:       to,
+			Username: config.SMTPUser,
+			Password: config.SMTPPassword,
+		})
+	}
+	return notifiers, nil
+}
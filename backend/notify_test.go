@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// notification is what a stand-in ntfy or Gotify server was sent
+type notification struct {
+	path    string
+	header  http.Header
+	body    string
+	title   string
+	message string
+}
+
+// notifyServer records what is posted to it, answering with status
+func notifyServer(t *testing.T, status int) (*httptest.Server, func() []notification) {
+	t.Helper()
+	var mu sync.Mutex
+	var got []notification
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		n := notification{path: r.URL.Path, header: r.Header, body: string(body)}
+		if r.Header.Get("Content-Type") == "application/json" {
+			var gotify struct{ Title, Message string }
+			json.Unmarshal(body, &gotify)
+			n.title, n.message = gotify.Title, gotify.Message
+		} else {
+			n.title, _ = new(mime.WordDecoder).DecodeHeader(r.Header.Get("Title"))
+			n.message = n.body
+		}
+		mu.Lock()
+		got = append(got, n)
+		mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []notification {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]notification(nil), got...)
+	}
+}
+
+// mail is a message a stand-in SMTP server was given
+type mail struct {
+	from string
+	to   []string
+	data string
+}
+
+// smtpServer is just enough of an SMTP server for net/smtp to deliver mail
+// to, it returns the address it listens on
+func smtpServer(t *testing.T) (string, func() []mail) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	var mu sync.Mutex
+	var got []mail
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				text := textproto.NewConn(conn)
+				text.PrintfLine("220 localhost ESMTP")
+				var m mail
+				for {
+					line, err := text.ReadLine()
+					if err != nil {
+						return
+					}
+					command := strings.ToUpper(line)
+					switch {
+					case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+						text.PrintfLine("250 localhost")
+					case strings.HasPrefix(command, "MAIL FROM:"):
+						m = mail{from: strings.Trim(line[len("MAIL FROM:"):], "<>")}
+						text.PrintfLine("250 OK")
+					case strings.HasPrefix(command, "RCPT TO:"):
+						m.to = append(m.to, strings.Trim(line[len("RCPT TO:"):], "<>"))
+						text.PrintfLine("250 OK")
+					case command == "DATA":
+						text.PrintfLine("354 go ahead")
+						data, err := ioutil.ReadAll(text.DotReader())
+						if err != nil {
+							return
+						}
+						m.data = string(data)
+						mu.Lock()
+						got = append(got, m)
+						mu.Unlock()
+						text.PrintfLine("250 OK")
+					case command == "QUIT":
+						text.PrintfLine("221 bye")
+						return
+					default:
+						text.PrintfLine("502 not implemented")
+					}
+				}
+			}()
+		}
+	}()
+	return listener.Addr().String(), func() []mail {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]mail(nil), got...)
+	}
+}
+
+// header returns a mail header, decoded
+func (m mail) header(name string) string {
+	reader := textproto.NewReader(bufio.NewReader(strings.NewReader(m.data)))
+	header, _ := reader.ReadMIMEHeader()
+	value, _ := new(mime.WordDecoder).DecodeHeader(header.Get(name))
+	return value
+}
+
+func TestNtfy(t *testing.T) {
+	server, got := notifyServer(t, http.StatusOK)
+	ntfy := &Ntfy{URL: server.URL + "/prices", Client: server.Client(), Token: "tk_secret"}
+	if err := ntfy.Notify("Prices over 100 øre tomorrow", "17:00–19:00 up to 180 øre/kWh"); err != nil {
+		t.Fatal(err)
+	}
+	n := got()
+	if len(n) != 1 {
+		t.Fatalf("got %d notifications", len(n))
+	}
+	if n[0].path != "/prices" || n[0].header.Get("Authorization") != "Bearer tk_secret" {
+		t.Errorf("posted to %s with %v", n[0].path, n[0].header)
+	}
+	if n[0].title != "Prices over 100 øre tomorrow" || n[0].message != "17:00–19:00 up to 180 øre/kWh" {
+		t.Errorf("got %q: %q", n[0].title, n[0].message)
+	}
+
+	failing, _ := notifyServer(t, http.StatusForbidden)
+	ntfy = &Ntfy{URL: failing.URL + "/prices", Client: failing.Client()}
+	if err := ntfy.Notify("title", "message"); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("got %v, want a 403 error", err)
+	}
+}
+
+func TestGotify(t *testing.T) {
+	server, got := notifyServer(t, http.StatusOK)
+	gotify := &Gotify{URL: server.URL + "/", Client: server.Client(), Token: "app-token"}
+	if err := gotify.Notify("Negative prices tomorrow", "13:00–15:00 down to -12 øre/kWh spot"); err != nil {
+		t.Fatal(err)
+	}
+	n := got()
+	if len(n) != 1 {
+		t.Fatalf("got %d notifications", len(n))
+	}
+	if n[0].path != "/message" || n[0].header.Get("X-Gotify-Key") != "app-token" {
+		t.Errorf("posted to %s with %v", n[0].path, n[0].header)
+	}
+	if n[0].title != "Negative prices tomorrow" || n[0].message != "13:00–15:00 down to -12 øre/kWh spot" {
+		t.Errorf("got %q: %q", n[0].title, n[0].message)
+	}
+}
+
+func TestMail(t *testing.T) {
+	addr, got := smtpServer(t)
+	m := &Mail{Server: addr, From: "display@example.com", To: []string{"a@example.com", "b@example.com"}}
+	if err := m.Notify("Cheapest 3h tomorrow", "02:00–05:00, avg 41 øre/kWh\nplan ahead"); err != nil {
+		t.Fatal(err)
+	}
+	mails := got()
+	if len(mails) != 1 {
+		t.Fatalf("got %d mails", len(mails))
+	}
+	mail := mails[0]
+	if mail.from != "display@example.com" || strings.Join(mail.to, ",") != "a@example.com,b@example.com" {
+		t.Errorf("mailed from %s to %v", mail.from, mail.to)
+	}
+	if subject := mail.header("Subject"); subject != "Cheapest 3h tomorrow" {
+		t.Errorf("subject %q", subject)
+	}
+	if to := mail.header("To"); to != "a@example.com, b@example.com" {
+		t.Errorf("to %q", to)
+	}
+	// the dot reader turns the line endings back into \n
+	if !strings.HasSuffix(mail.data, "\n\n02:00–05:00, avg 41 øre/kWh\nplan ahead\n") {
+		t.Errorf("mailed %q", mail.data)
+	}
+}
+
+func TestNewNotifiers(t *testing.T) {
+	config := &Config{NotifyService: "ntfy", NotifyURL: "https://ntfy.sh/x", SMTPServer: "localhost:25", MailTo: "a@example.com, ,b@example.com"}
+	notifiers, err := NewNotifiers(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(notifiers) != 2 {
+		t.Fatalf("got %d notifiers", len(notifiers))
+	}
+	if m, ok := notifiers[1].(*Mail); !ok || len(m.To) != 2 {
+		t.Errorf("got %+v", notifiers[1])
+	}
+	config.NotifyService = "pushover"
+	if _, err = NewNotifiers(config); err == nil {
+		t.Error("no error for an unknown service")
+	}
+}
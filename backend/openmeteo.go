@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const openMeteoURL = "https://api.open-meteo.com/v1/forecast"
+
+// OpenMeteo gets forecasts from open-meteo.com
+type OpenMeteo struct {
+	BaseURL string
+	Client  *http.Client
+}
+
+// Begin Open-Meteo Data Struct
+type openMeteoData struct {
+	Timezone string
+	Current  openMeteoCurrent
+	Hourly   openMeteoHourly
+	Daily    openMeteoDaily
+}
+
+type openMeteoCurrent struct {
+	Time             string
+	IsDay            int     `json:"is_day"`
+	Temperature      float64 `json:"temperature_2m"`
+	RelativeHumidity float64 `json:"relative_humidity_2m"`
+	Precipitation    float64
+	WeatherCode      int     `json:"weather_code"`
+	PressureMsl      float64 `json:"pressure_msl"`
+	WindSpeed        float64 `json:"wind_speed_10m"`
+	WindDirection    float64 `json:"wind_direction_10m"`
+	WindGusts        float64 `json:"wind_gusts_10m"`
+	Visibility       float64
+}
+
+type openMeteoHourly struct {
+	Time          []string
+	Temperature   []float64 `json:"temperature_2m"`
+	Precipitation []float64
+	WeatherCode   []int `json:"weather_code"`
+}
+
+type openMeteoDaily struct {
+	Time             []string
+	TemperatureMax   []float64 `json:"temperature_2m_max"`
+	TemperatureMin   []float64 `json:"temperature_2m_min"`
+	PrecipitationSum []float64 `json:"precipitation_sum"`
+	UvIndexMax       []float64 `json:"uv_index_max"`
+	Sunrise          []string
+	Sunset           []string
+}
+
+// End Open-Meteo Data Struct
+
+func (o *OpenMeteo) Fetch(latitude, longitude string) (*WeatherReport, error) {
+	resp, err := o.Client.Get(o.url(latitude, longitude))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("open-meteo: %s", resp.Status)
+	}
+	var weather openMeteoData
+	err = json.NewDecoder(resp.Body).Decode(&weather)
+	if err != nil {
+		return nil, fmt.Errorf("open-meteo: %w", err)
+	}
+	return weather.report(time.Now())
+}
+
+func (o *OpenMeteo) url(latitude, longitude string) string {
+	query := url.Values{}
+	query.Set("latitude", latitude)
+	query.Set("longitude", longitude)
+	query.Set("current", "is_day,temperature_2m,relative_humidity_2m,precipitation,weather_code,"+
+		"pressure_msl,wind_speed_10m,wind_direction_10m,wind_gusts_10m,visibility")
+	query.Set("hourly", "temperature_2m,precipitation,weather_code")
+	query.Set("daily", "temperature_2m_max,temperature_2m_min,precipitation_sum,uv_index_max,sunrise,sunset")
+	query.Set("wind_speed_unit", "ms")
+	query.Set("timezone", "auto")
+	query.Set("forecast_days", "7")
+	return o.BaseURL + "?" + query.Encode()
+}
+
+// report normalises the response, dropping the hours before now as
+// open-meteo always starts the hourly forecast at midnight
+func (weather *openMeteoData) report(now time.Time) (*WeatherReport, error) {
+	loc, err := time.LoadLocation(weather.Timezone)
+	if err != nil {
+		loc = time.Local
+	}
+	parse := func(value string) (time.Time, error) {
+		t, err := time.ParseInLocation("2006-01-02T15:04", value, loc)
+		if err != nil {
+			return t, fmt.Errorf("open-meteo: %w", err)
+		}
+		return t, nil
+	}
+
+	report := new(WeatherReport)
+	c := weather.Current
+	report.Current = Observation{
+		Description:         openMeteoDescription(c.WeatherCode, c.IsDay == 1),
+		Temp:                c.Temperature,
+		PrecipitationAmount: c.Precipitation,
+		WindSpeed:           c.WindSpeed,
+		WindGust:            c.WindGusts,
+		WindDirection:       compassDirection(c.WindDirection),
+		Humidity:            c.RelativeHumidity,
+		Pressure:            c.PressureMsl,
+		Visibility:          c.Visibility,
+	}
+	report.Current.Sky, report.Current.Precipitation = openMeteoSymbol(c.WeatherCode)
+	if report.Current.Time, err = parse(c.Time); err != nil {
+		return nil, err
+	}
+
+	h := weather.Hourly
+	if len(h.Temperature) != len(h.Time) || len(h.Precipitation) != len(h.Time) ||
+		len(h.WeatherCode) != len(h.Time) {
+		return nil, fmt.Errorf("open-meteo: hourly series have different lengths")
+	}
+	currentHour := now.In(loc).Truncate(time.Hour)
+	for i := range h.Time {
+		t, err := parse(h.Time[i])
+		if err != nil {
+			return nil, err
+		}
+		if t.Before(currentHour) {
+			continue
+		}
+		o := Observation{
+			Time:                t,
+			Description:         openMeteoDescription(h.WeatherCode[i], true),
+			Temp:                h.Temperature[i],
+			PrecipitationAmount: h.Precipitation[i],
+		}
+		o.Sky, o.Precipitation = openMeteoSymbol(h.WeatherCode[i])
+		report.Hours = append(report.Hours, o)
+	}
+
+	d := weather.Daily
+	if len(d.TemperatureMax) != len(d.Time) || len(d.TemperatureMin) != len(d.Time) ||
+		len(d.PrecipitationSum) != len(d.Time) || len(d.UvIndexMax) != len(d.Time) {
+		return nil, fmt.Errorf("open-meteo: daily series have different lengths")
+	}
+	for i := range d.Time {
+		date, err := time.ParseInLocation("2006-01-02", d.Time[i], loc)
+		if err != nil {
+			return nil, fmt.Errorf("open-meteo: %w", err)
+		}
+		report.Days = append(report.Days, DaySummary{
+			Date:          date,
+			MinTemp:       d.TemperatureMin[i],
+			MaxTemp:       d.TemperatureMax[i],
+			Precipitation: d.PrecipitationSum[i],
+			UV:            d.UvIndexMax[i],
+		})
+	}
+	if len(d.Sunrise) > 0 && len(d.Sunset) > 0 {
+		if report.Sunrise, err = parse(d.Sunrise[0]); err != nil {
+			return nil, err
+		}
+		if report.Sunset, err = parse(d.Sunset[0]); err != nil {
+			return nil, err
+		}
+	}
+	return report, nil
+}
+
+// openMeteoSymbol maps a WMO weather code onto the cover and precipitation
+// drawn on the weather graph
+func openMeteoSymbol(code int) (Cover, Precipitation) {
+	switch code {
+	case 0, 1:
+		return Clear, None
+	case 2:
+		return Broken, None
+	case 3:
+		return Cloudy, None
+	case 45, 48:
+		return Fog, None
+	case 51, 53, 61:
+		return Cloudy, LightRain
+	case 55, 63, 65, 95, 96, 99:
+		return Cloudy, HeavyRain
+	case 56, 66:
+		return Cloudy, LightSleet
+	case 57, 67:
+		return Cloudy, HeavySleet
+	case 71, 77:
+		return Cloudy, LightSnow
+	case 73, 75:
+		return Cloudy, HeavySnow
+	case 80:
+		return Broken, LightRain
+	case 81, 82:
+		return Broken, HeavyRain
+	case 85:
+		return Broken, LightSnow
+	case 86:
+		return Broken, HeavySnow
+	}
+	return Clear, None
+}
+
+func openMeteoDescription(code int, day bool) string {
+	switch code {
+	case 0, 1:
+		if day {
+			return "Sunny"
+		}
+		return "Clear"
+	case 2:
+		return "Broken Clouds"
+	case 3:
+		return "Cloudy"
+	case 45, 48:
+		return "Fog"
+	case 51, 53, 55:
+		return "Drizzle"
+	case 61, 80:
+		return "Light Rain"
+	case 63, 65, 81, 82:
+		return "Heavy Rain"
+	case 56, 57, 66, 67:
+		return "Sleet"
+	case 71, 77, 85:
+		return "Light Snow"
+	case 73, 75, 86:
+		return "Heavy Snow"
+	case 95, 96, 99:
+		return "Thunderstorm"
+	}
+	return fmt.Sprintf("Undefined %d", code)
+}
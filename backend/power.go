@@ -2,10 +2,10 @@ package main
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"math"
-	"strconv"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -13,227 +13,335 @@ import (
 
 type Power struct {
 	Db *sql.DB
+	// Location is the time zone the usage data is in
+	Location *time.Location
+	// Model adds tariffs and taxes to the stored spot prices, they are
+	// used as they are when it is nil
+	Model *PriceModel
+	// Thresholds are fixed limits between the price levels in øre/kWh, when
+	// empty the levels come from recent prices
+	Thresholds []float64
+	// SubMeters are the names of the meters behind the main one, what they
+	// do not measure is the remainder
+	SubMeters []string
 }
 
 type Useage struct {
-	Amount     string
-	Date       string
-	Cost       string
-	Efficiency string
+	Amount string
+	Date   string
+	Cost   string
+	// Score is the load-shifting score, how much of the possible saving on
+	// the average price was made, and empty when there was none to make.
+	// CheapShare is the percentage used in the cheapest third of the hours
+	Score      string
+	CheapShare string
+	// Exported is the kWh fed into the grid and Earnings what was paid for
+	// it, NetCost is Cost less Earnings. They are empty when nothing was
+	// exported
+	Exported string
+	Earnings string
+	NetCost  string
+	// CO2 is the kg emitted producing what was used and Intensity the
+	// average g/kWh, both are for the readings the emissions are known for
+	CO2       string
+	Intensity string
+	// SelfConsumption is the percentage of the solar production used in the
+	// house rather than exported, empty without production readings
+	SelfConsumption string
 }
 
-func NewPower(path string) *Power {
+// ErrNoPrice is returned when there is no price for a time
+var ErrNoPrice = errors.New("no price")
+
+func NewPower(path string, loc *time.Location) (*Power, error) {
 	power := new(Power)
+	power.Location = loc
 	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
 	power.Db = db
+	err = power.Migrate()
 	if err != nil {
-		log.Fatal(err)
+		db.Close()
+		return nil, err
 	}
-	return power
+	return power, nil
 }
 
-// Cost returns the cost of electricity in a certain time period
-// exact will from the start of the hour until the time given
-// otherwise it'll be between exact hours
-func (power *Power) Cost(t time.Time, exact bool) float64 {
-	lowerBound := t.Format("2006-01-02T15:00:00")
-	var upperBound string
-	if exact {
-		upperBound = t.Format("2006-01-02T15:04:05")
-	} else {
-		// Hour is as costs are given in 1 hour slots
-		upperBound = t.Add(time.Hour).Format("2006-01-02T15:00:00")
-	}
-	query := "select price, end from prices where end >= $1 and end < $2"
-	rows, err := power.Db.Query(query, lowerBound, upperBound)
+// Cost returns the price paid for electricity at t in øre/kWh, whatever the
+// length of the interval it falls in
+func (power *Power) Cost(t time.Time) (float64, error) {
+	price, err := power.PriceAt(t)
 	if err != nil {
-		log.Fatal(err)
-	}
-	defer rows.Close()
-	if rows.Next() {
-		var price, validFrom string
-		err = rows.Scan(&price, &validFrom)
-		if err != nil {
-			log.Fatal(err)
-		}
-		return fmtPrice(price, validFrom)
+		return 0, err
 	}
-	fmt.Println("Missing cost for", t)
-	return 0
+	return power.Model.Apply(price, power.Location).Price * 100, nil
 }
 
-// CurrentCost returns the electrical cost right now
-func (power *Power) CurrentCost() int {
-	return int(math.Round(power.Cost(time.Now(), false)))
+// AverageCost returns the average price in øre/kWh over start until end,
+// weighted by how much of the period each price covers
+func (power *Power) AverageCost(start, end time.Time) (float64, error) {
+	prices, err := power.PricesBetween(start, end)
+	if err != nil {
+		return 0, err
+	}
+	return averagePrice(power.consumerPrices(prices), start, end)
 }
 
-// CostData returns the latest two days worth of hourly pricing data
-func (power *Power) CostData() (prices []int, currentPos int) {
-	yesterday := time.Now().Add(-24*time.Hour).Format("2006-01-02") + "T" + getQueryHour() + ":00:00+0200"
-	tomorrow := time.Now().Add(48*time.Hour).Format("2006-01-02T00:00:00") + "+0200"
-	query := "select price, start from prices where end > $1 and end < $2"
-	rows, err := power.Db.Query(query, yesterday, tomorrow)
-	defer rows.Close()
+// AverageExportPrice returns the average paid for export in øre/kWh over
+// start until end, weighted like AverageCost
+func (power *Power) AverageExportPrice(start, end time.Time) (float64, error) {
+	prices, err := power.PricesBetween(start, end)
 	if err != nil {
-		log.Fatal(err)
+		return 0, err
 	}
-	for rows.Next() {
-		var price, validFrom string
-		err = rows.Scan(&price, &validFrom)
-		if err != nil {
-			log.Fatal(err)
+	return averagePrice(power.exportPrices(prices), start, end)
+}
+
+// averagePrice is the average of prices over start until end in øre/kWh
+func averagePrice(prices []PriceInterval, start, end time.Time) (float64, error) {
+	var covered time.Duration
+	sum := 0.0
+	for _, p := range prices {
+		from, to := p.Start, p.End
+		if from.Before(start) {
+			from = start
 		}
-		prices = append(prices, int(math.Round(fmtPrice(price, validFrom))))
+		if to.After(end) {
+			to = end
+		}
+		covered += to.Sub(from)
+		sum += p.Price * float64(to.Sub(from))
+	}
+	if covered == 0 {
+		return 0, fmt.Errorf("%w between %s and %s", ErrNoPrice, start, end)
 	}
+	return sum / float64(covered) * 100, nil
+}
+
+// CurrentCost returns the electrical cost right now
+func (power *Power) CurrentCost() (int, error) {
+	cost, err := power.Cost(time.Now())
+	return int(math.Round(cost)), err
+}
 
-	pos, err := strconv.Atoi(time.Now().Format("15"))
+// CostData returns the prices for today and tomorrow, or yesterday and
+// today if tomorrow's are not known yet, along with the start of the first
+// of the two days
+func (power *Power) CostData(now time.Time) (prices []PriceInterval, start time.Time, err error) {
+	now = now.In(power.Location)
+	// days are found with time.Date, as they are 23 or 25 hours long when
+	// the clocks change
+	day := func(offset int) time.Time {
+		return time.Date(now.Year(), now.Month(), now.Day()+offset, 0, 0, 0, 0, power.Location)
+	}
+	prices, err = power.PricesBetween(day(-1), day(2))
 	if err != nil {
-		log.Fatal(err)
+		return nil, start, err
+	}
+	if len(prices) == 0 {
+		return nil, start, fmt.Errorf("%w between %s and %s", ErrNoPrice, day(-1), day(2))
 	}
 
-	// if tomorrow's data is available, remove yesterday's
-	if len(prices) > 48 {
-		dif := len(prices) - 48
-		return prices[dif:], pos
+	start, end := day(-1), day(1)
+	if prices[len(prices)-1].End.After(day(1)) {
+		start, end = day(0), day(2)
+	}
+	var shown []PriceInterval
+	for _, p := range prices {
+		if p.End.After(start) && p.Start.Before(end) {
+			shown = append(shown, p)
+		}
 	}
-	return prices, pos + 24
+	return power.consumerPrices(shown), start, nil
 }
 
-// getQueryHour exists as the incoming data is always in UTC+0200
-func getQueryHour() string {
-	_, offset := time.Now().Zone()
-	if offset == 2*60*60 {
-		return "00"
+// aggregatePrices averages sorted intervals into slots of the given
+// length, dropping slots that are not complete. Intervals longer than a
+// slot are split up, so hourly prices can be drawn next to 15 minute ones
+func aggregatePrices(intervals []PriceInterval, resolution time.Duration) []PriceInterval {
+	var split []PriceInterval
+	for _, p := range intervals {
+		for start := p.Start; start.Before(p.End); start = start.Add(resolution) {
+			end := start.Add(resolution)
+			if end.After(p.End) {
+				end = p.End
+			}
+			split = append(split, PriceInterval{Start: start, End: end, Price: p.Price})
+		}
 	}
-	return "01"
+
+	var out []PriceInterval
+	for i := 0; i < len(split); {
+		slot := PriceInterval{
+			Start: split[i].Start.Truncate(resolution),
+		}
+		slot.End = slot.Start.Add(resolution)
+		var covered time.Duration
+		sum := 0.0
+		for ; i < len(split) && split[i].Start.Before(slot.End); i++ {
+			length := split[i].End.Sub(split[i].Start)
+			covered += length
+			sum += split[i].Price * float64(length)
+		}
+		if covered == resolution {
+			slot.Price = sum / float64(resolution)
+			out = append(out, slot)
+		}
+	}
+	return out
 }
 
-func (power *Power) mostRecentDay() time.Time {
+// mostRecentDay is the start of the last local day the main meter has
+// used power on
+func (power *Power) mostRecentDay() (time.Time, error) {
 	query := `select
-				end
+				start
 			  from
 				useage
 			  where
 				amount is not '0'
+				and meter = $1
 			  order by
 				start desc
 			  limit
 				1`
-	rows, err := power.Db.Query(query)
-	defer rows.Close()
+	var start string
+	err := power.Db.QueryRow(query, MainMeter).Scan(&start)
+	if err == sql.ErrNoRows {
+		return time.Time{}, errors.New("no latest date available")
+	}
 	if err != nil {
-		log.Fatal(err)
+		return time.Time{}, err
 	}
-	for rows.Next() {
-		var date string
-		err = rows.Scan(&date)
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		// iso format date in first 10 chars
-		t, err := time.Parse("2006-01-02", date[:10])
-		if err != nil {
-			log.Fatal(err)
-		}
-		// TODO: Set this as config
-		loc, err := time.LoadLocation("Europe/Copenhagen")
-		if err != nil {
-			log.Fatal(err)
-		}
-		t = t.In(loc)
-		_, offset := t.Zone()
-		t = t.Add(-1 * time.Second * time.Duration(offset))
-		return t
+	t, err := time.Parse(usageFormat, start)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("bad usage date %q: %w", start, err)
 	}
-	log.Fatal("No latest date available")
-	return time.Now()
+	t = t.In(power.Location)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, power.Location), nil
 }
 
-func (power *Power) powerData(offset, days int) (usage Useage) {
-	latest := power.mostRecentDay()
-
-	t2 := latest.Add(time.Hour * 24)
-	t2 = t2.AddDate(0, 0, -1*offset)
-	_, t2off := t2.Zone()
-	t2 = t2.Add(-1 * time.Duration(t2off) * time.Second)
-	endOfDay := t2.Format("2006-01-02T15:00:00.000Z")
+// powerData adds up a meter's use over days days, offset days before the
+// most recent day the main meter has data for
+func (power *Power) powerData(meter string, offset, days int) (usage Useage, err error) {
+	latest, err := power.mostRecentDay()
+	if err != nil {
+		return usage, err
+	}
 
-	t2 = latest.AddDate(0, 0, -(offset + days - 1))
-	_, t2off = t2.Zone()
-	t2 = t2.Add(-1 * time.Duration(t2off) * time.Second)
-	startOfDay := t2.Format("2006-01-02T15:00:00.000Z")
+	// the days are counted on the calendar, so a day the clocks change on
+	// has 23 or 25 hours
+	periodStart := time.Date(latest.Year(), latest.Month(), latest.Day()-offset-days+1, 0, 0, 0, 0, power.Location)
+	periodEnd := time.Date(latest.Year(), latest.Month(), latest.Day()-offset+1, 0, 0, 0, 0, power.Location)
+	emissions, err := power.EmissionsBetween(periodStart, periodEnd)
+	if err != nil {
+		return usage, err
+	}
 
-	amt, cost, lowestRate := 0.0, 0.0, 0.0
-	query := `select
-				amount, start, end
-			  from
-				useage
-			  where
-				start >= $1
-				and end <= $2`
-	rows, err := power.Db.Query(query, startOfDay, endOfDay)
-	defer rows.Close()
+	amt, cost := 0.0, 0.0
+	exported, earnings := 0.0, 0.0
+	// co2 is in g, along with the kWh it is known for
+	co2, co2Amount := 0.0, 0.0
+	readings, err := power.MeterUsageBetween(meter, periodStart, periodEnd)
 	if err != nil {
-		log.Fatal(err)
+		return usage, err
 	}
-	for rows.Next() {
-		var a, start, end string
-		err = rows.Scan(&a, &start, &end)
-		if err != nil {
-			log.Fatal(err)
-		}
-		a2, err := strconv.ParseFloat(a, 64)
-		if err != nil {
-			log.Fatal(err)
+	for _, r := range readings {
+		amt += r.Amount
+		// prices can change within a reading, e.g. 15 minute prices with
+		// hourly readings
+		rate, err := power.AverageCost(r.Start, r.End)
+		if errors.Is(err, ErrNoPrice) {
+			// count the usage but carry on without its cost
+			log.Println(err)
+		} else if err != nil {
+			return usage, err
 		}
-		amt += a2
-		t, err := time.Parse("2006-01-02T15:04:05.000Z", start)
-		if err != nil {
-			log.Fatal(err)
+		cost += r.Amount * rate
+		if r.Exported > 0 {
+			exported += r.Exported
+			exportRate, err := power.AverageExportPrice(r.Start, r.End)
+			if err != nil && !errors.Is(err, ErrNoPrice) {
+				return usage, err
+			}
+			earnings += r.Exported * exportRate
 		}
-		// TODO: Set this as config
-		loc, err := time.LoadLocation("Europe/Copenhagen")
-		if err != nil {
-			log.Fatal(err)
+		if intensity, ok := averageIntensity(emissions, r.Start, r.End); ok {
+			co2 += r.Amount * intensity
+			co2Amount += r.Amount
 		}
-		t = t.In(loc)
-		rate := power.Cost(t, false)
-		cost += a2 * rate
-		if rate < lowestRate || lowestRate == 0.0 {
-			lowestRate = rate
-		}
-		usage.Date = start[:10]
+		usage.Date = r.Start.In(power.Location).Format("2006-01-02")
 	}
 	usage.Amount = fmt.Sprintf("%0.2f", amt)
-	cheapest := amt * lowestRate
-	usage.Efficiency = fmt.Sprintf("%0.1f", cost/cheapest*100)
+	prices, err := power.PricesBetween(periodStart, periodEnd)
+	if err != nil {
+		return usage, err
+	}
+	shifting := totalShifting(analyseShifting(readings, power.consumerPrices(prices), power.Location))
+	if score, ok := shifting.Score(); ok {
+		usage.Score = fmt.Sprintf("%0.0f", score)
+	}
+	usage.CheapShare = fmt.Sprintf("%0.0f", shifting.CheapShare())
 	usage.Cost = fmt.Sprintf("%0.2f", cost/100)
-	return
+	if exported > 0 {
+		usage.Exported = fmt.Sprintf("%0.2f", exported)
+		usage.Earnings = fmt.Sprintf("%0.2f", earnings/100)
+		usage.NetCost = fmt.Sprintf("%0.2f", (cost-earnings)/100)
+	}
+	if co2Amount > 0 {
+		usage.CO2 = fmt.Sprintf("%0.1f", co2/1000)
+		usage.Intensity = fmt.Sprintf("%0.0f", co2/co2Amount)
+	}
+
+	// solar production is behind the main meter
+	if meter != MainMeter {
+		return usage, nil
+	}
+	production, err := power.ProductionBetween(periodStart, periodEnd)
+	if err != nil {
+		return usage, err
+	}
+	produced := 0.0
+	for _, r := range production {
+		produced += r.Amount
+	}
+	if produced > 0 {
+		selfConsumption := math.Max(produced-exported, 0) / produced * 100
+		usage.SelfConsumption = fmt.Sprintf("%0.1f", selfConsumption)
+	}
+	return usage, nil
 }
 
 // DayUseage returns the total amount of electricity consumed for the most recent
 // day that has data
-func (power *Power) DayUseage() Useage {
-	return power.powerData(0, 1)
+func (power *Power) DayUseage() (Useage, error) {
+	return power.powerData(MainMeter, 0, 1)
 }
 
 // PrevDayUseage returns the amount of electricity consumed for the second most recent
 // day that has data
-func (power *Power) PrevDayUseage() Useage {
-	return power.powerData(1, 1)
+func (power *Power) PrevDayUseage() (Useage, error) {
+	return power.powerData(MainMeter, 1, 1)
 }
 
 // WeekUseage returns the amount of power consumed in the last 7 days
-func (power *Power) WeekUseage() Useage {
-	return power.powerData(0, 7)
+func (power *Power) WeekUseage() (Useage, error) {
+	return power.powerData(MainMeter, 0, 7)
 }
 
-func fmtPrice(price, date string) float64 {
-	p, err := strconv.ParseFloat(price, 64)
-	if err != nil {
-		log.Fatal(err)
-	}
+// MeterDayUseage is DayUseage for one meter, a sub-meter or the remainder
+func (power *Power) MeterDayUseage(meter string) (Useage, error) {
+	return power.powerData(meter, 0, 1)
+}
+
+// MeterPrevDayUseage is PrevDayUseage for one meter
+func (power *Power) MeterPrevDayUseage(meter string) (Useage, error) {
+	return power.powerData(meter, 1, 1)
+}
 
-	return p * 100
+// MeterWeekUseage is WeekUseage for one meter
+func (power *Power) MeterWeekUseage(meter string) (Useage, error) {
+	return power.powerData(meter, 0, 7)
 }
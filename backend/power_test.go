@@ -0,0 +1,159 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// storeSteps stores a spot price of 1 DKK/kWh for every step from start
+// until end
+func storeSteps(t *testing.T, power *Power, start, end time.Time, step time.Duration) {
+	t.Helper()
+	var prices []PriceInterval
+	for s := start; s.Before(end); s = s.Add(step) {
+		prices = append(prices, PriceInterval{Start: s, End: s.Add(step), Price: 1})
+	}
+	if err := power.StorePrices(prices); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// storeHourlyUsage stores 1 kWh for every hour from start until end
+func storeHourlyUsage(t *testing.T, power *Power, start, end time.Time) {
+	t.Helper()
+	var readings []Reading
+	for s := start; s.Before(end); s = s.Add(time.Hour) {
+		readings = append(readings, Reading{Start: s, End: s.Add(time.Hour), Amount: 1})
+	}
+	if err := power.StoreUsage(readings); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCostDataDaylightSaving(t *testing.T) {
+	loc := copenhagen(t)
+	date := func(month time.Month, day, hour, min int) time.Time {
+		return time.Date(2026, month, day, hour, min, 0, 0, loc)
+	}
+	tests := []struct {
+		name     string
+		now      time.Time
+		from, to time.Time
+		step     time.Duration
+		start    time.Time
+		count    int
+		// the day usage is added up for, offset days before the last one
+		// with readings, and the kWh used on it at 1 kWh an hour
+		offset int
+		day    string
+		used   float64
+	}{
+		// the clocks go forward on 29 March, that day has 92 quarter hours
+		{"before spring, tomorrow unknown", date(3, 28, 12, 0), date(3, 27, 0, 0), date(3, 29, 0, 0), 15 * time.Minute, date(3, 27, 0, 0), 96 + 96, 0, "2026-03-28", 24},
+		{"before spring, tomorrow known", date(3, 28, 14, 0), date(3, 27, 0, 0), date(3, 30, 0, 0), 15 * time.Minute, date(3, 28, 0, 0), 96 + 92, 1, "2026-03-28", 24},
+		{"spring, tomorrow unknown", date(3, 29, 12, 0), date(3, 28, 0, 0), date(3, 30, 0, 0), 15 * time.Minute, date(3, 28, 0, 0), 96 + 92, 0, "2026-03-29", 23},
+		{"spring, tomorrow known", date(3, 29, 14, 0), date(3, 28, 0, 0), date(3, 31, 0, 0), 15 * time.Minute, date(3, 29, 0, 0), 92 + 96, 1, "2026-03-29", 23},
+		{"after spring", date(3, 30, 10, 0), date(3, 29, 0, 0), date(3, 31, 0, 0), 15 * time.Minute, date(3, 29, 0, 0), 92 + 96, 1, "2026-03-29", 23},
+		{"spring, hourly", date(3, 29, 14, 0), date(3, 28, 0, 0), date(3, 31, 0, 0), time.Hour, date(3, 29, 0, 0), 23 + 24, 1, "2026-03-29", 23},
+		// and back on 25 October, with 100 quarter hours
+		{"autumn, tomorrow unknown", date(10, 25, 12, 0), date(10, 24, 0, 0), date(10, 26, 0, 0), 15 * time.Minute, date(10, 24, 0, 0), 96 + 100, 0, "2026-10-25", 25},
+		{"autumn, tomorrow known", date(10, 25, 14, 0), date(10, 24, 0, 0), date(10, 27, 0, 0), 15 * time.Minute, date(10, 25, 0, 0), 100 + 96, 1, "2026-10-25", 25},
+		// the second 02:30 that morning
+		{"autumn, repeated hour", date(10, 25, 1, 30).Add(2 * time.Hour), date(10, 24, 0, 0), date(10, 26, 0, 0), 15 * time.Minute, date(10, 24, 0, 0), 96 + 100, 0, "2026-10-25", 25},
+		{"after autumn", date(10, 26, 10, 0), date(10, 25, 0, 0), date(10, 27, 0, 0), 15 * time.Minute, date(10, 25, 0, 0), 100 + 96, 1, "2026-10-25", 25},
+		{"autumn, hourly", date(10, 25, 14, 0), date(10, 24, 0, 0), date(10, 27, 0, 0), time.Hour, date(10, 25, 0, 0), 25 + 24, 1, "2026-10-25", 25},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			power := testPower(t, loc)
+			storeSteps(t, power, test.from, test.to, test.step)
+			storeHourlyUsage(t, power, test.from, test.to)
+			prices, start, err := power.CostData(test.now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !start.Equal(test.start) {
+				t.Errorf("starts at %s, want %s", start, test.start)
+			}
+			if len(prices) != test.count {
+				t.Fatalf("got %d prices, want %d", len(prices), test.count)
+			}
+			end := test.start.AddDate(0, 0, 2)
+			if !prices[0].Start.Equal(test.start) || !prices[len(prices)-1].End.Equal(end) {
+				t.Errorf("prices run from %s until %s, want %s until %s", prices[0].Start, prices[len(prices)-1].End, test.start, end)
+			}
+			for i := 1; i < len(prices); i++ {
+				if !prices[i].Start.Equal(prices[i-1].End) {
+					t.Errorf("gap between %s and %s", prices[i-1].End, prices[i].Start)
+				}
+			}
+
+			usage, err := power.powerData(MainMeter, test.offset, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if usage.Date != test.day || usage.Amount != fmt.Sprintf("%0.2f", test.used) {
+				t.Errorf("used %s kWh on %s, want %0.2f on %s", usage.Amount, usage.Date, test.used, test.day)
+			}
+		})
+	}
+}
+
+func TestCostDataNoPrices(t *testing.T) {
+	power := testPower(t, copenhagen(t))
+	if _, _, err := power.CostData(time.Now()); !errors.Is(err, ErrNoPrice) {
+		t.Errorf("got %v, want ErrNoPrice", err)
+	}
+}
+
+func TestPowerDataExport(t *testing.T) {
+	power := testPower(t, time.UTC)
+	hour := func(day, hour int) time.Time {
+		return time.Date(2026, 6, day, hour, 0, 0, 0, time.UTC)
+	}
+	// 1 kWh used every hour, and 2 kWh exported each hour from 10 to 14 on
+	// the 10th
+	var readings []Reading
+	for s := hour(9, 0); s.Before(hour(11, 0)); s = s.Add(time.Hour) {
+		r := Reading{Start: s, End: s.Add(time.Hour), Amount: 1}
+		if s.Day() == 10 && s.Hour() >= 10 && s.Hour() < 14 {
+			r.Exported = 2
+		}
+		readings = append(readings, r)
+	}
+	if err := power.StoreUsage(readings); err != nil {
+		t.Fatal(err)
+	}
+	err := power.StoreProduction([]Reading{{Start: hour(10, 8), End: hour(10, 16), Amount: 12}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	storeSteps(t, power, hour(9, 0), hour(11, 0), time.Hour)
+	// 1.875 DKK/kWh paid and 0.90 DKK/kWh earned
+	power.Model = &PriceModel{
+		Tariffs:       []Tariff{{Name: "markup", Price: 0.5}},
+		VAT:           25,
+		ExportTariffs: []Tariff{{Name: "export fee", Price: 0.1}},
+	}
+
+	usage, err := power.powerData(MainMeter, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Useage{Amount: "24.00", Date: "2026-06-10", Cost: "45.00", Exported: "8.00", Earnings: "7.20", NetCost: "37.80", SelfConsumption: "33.3"}
+	if usage.Amount != want.Amount || usage.Date != want.Date || usage.Cost != want.Cost || usage.Exported != want.Exported ||
+		usage.Earnings != want.Earnings || usage.NetCost != want.NetCost || usage.SelfConsumption != want.SelfConsumption {
+		t.Errorf("got %+v, want %+v", usage, want)
+	}
+
+	// nothing was exported the day before
+	usage, err = power.powerData(MainMeter, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Cost != "45.00" || usage.Exported != "" || usage.Earnings != "" || usage.NetCost != "" || usage.SelfConsumption != "" {
+		t.Errorf("got %+v without export", usage)
+	}
+}
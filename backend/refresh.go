@@ -0,0 +1,144 @@
+package main
+
+import (
+	"image"
+	"sort"
+)
+
+// RefreshPolicy decides when the panel gets a full refresh instead of only
+// updating the areas that changed
+type RefreshPolicy struct {
+	// FullEvery forces a full refresh after this many partial ones, to
+	// clear the ghosting partial refreshes leave behind
+	FullEvery int
+	// MaxArea is the fraction of the screen that can change before a full
+	// refresh is used anyway
+	MaxArea float64
+}
+
+// Refresh is what needs sending to the panel for the latest frame
+type Refresh struct {
+	Full bool
+	// Windows are the areas that changed, aligned to whole bytes horizontally
+	Windows []image.Rectangle
+	// Image is the whole frame in OneBitImage format
+	Image []byte
+	// Previous is the frame the windows were diffed against
+	Previous []byte
+}
+
+// SetPrevious sets the frame currently shown on the panel, e.g. when it was
+// saved by an earlier run
+func (screen *Screen) SetPrevious(frame []byte, partials int) {
+	if len(frame) != screen.Width*screen.Height/8 {
+		return
+	}
+	screen.previous = frame
+	screen.Partials = partials
+}
+
+// Refresh works out how to update the panel from the bytes of the frame that
+// differ from the last one refreshed. Every frame is drawn from scratch, so
+// the diff rather than what was drawn decides what changed. The new frame
+// becomes the one later refreshes are diffed against
+func (screen *Screen) Refresh(policy RefreshPolicy) *Refresh {
+	refresh := new(Refresh)
+	refresh.Image = screen.OneBitImage()
+	refresh.Previous = screen.previous
+	if screen.previous == nil {
+		refresh.Full = true
+	} else {
+		refresh.Windows = screen.changedWindows(refresh.Image)
+		area := 0
+		for _, w := range refresh.Windows {
+			area += w.Dx() * w.Dy()
+		}
+		if float64(area) > policy.MaxArea*float64(screen.Width*screen.Height) {
+			refresh.Full = true
+		}
+		if len(refresh.Windows) > 0 && screen.Partials >= policy.FullEvery {
+			refresh.Full = true
+		}
+	}
+
+	if refresh.Full {
+		refresh.Windows = []image.Rectangle{screen.Image.Bounds()}
+		screen.Partials = 0
+	} else if len(refresh.Windows) > 0 {
+		screen.Partials++
+	}
+	screen.previous = refresh.Image
+	return refresh
+}
+
+// windowGap is how close, in pixels, changes can be and still be refreshed
+// as one window rather than two
+const windowGap = 16
+
+// changedWindows finds the bytes that differ from the previous frame and
+// groups them into windows, changes further apart than windowGap getting
+// windows of their own, top to bottom
+func (screen *Screen) changedWindows(frame []byte) []image.Rectangle {
+	stride := screen.Width / 8
+
+	// rows are scanned top down, growing the windows still within reach
+	var windows, open []image.Rectangle
+	for y := 0; y < screen.Height; y++ {
+		var runs []image.Rectangle
+		for col := 0; col < stride; col++ {
+			i := y*stride + col
+			if frame[i] == screen.previous[i] {
+				continue
+			}
+			if n := len(runs); n > 0 && col*8-runs[n-1].Max.X <= windowGap {
+				runs[n-1].Max.X = col*8 + 8
+				continue
+			}
+			runs = append(runs, image.Rect(col*8, y, col*8+8, y+1))
+		}
+		reach := open[:0]
+		for _, w := range open {
+			if y-w.Max.Y > windowGap {
+				windows = append(windows, w)
+			} else {
+				reach = append(reach, w)
+			}
+		}
+		open = reach
+		for _, run := range runs {
+			near := run.Inset(-windowGap)
+			kept := open[:0]
+			for _, w := range open {
+				if w.Overlaps(near) {
+					run = run.Union(w)
+				} else {
+					kept = append(kept, w)
+				}
+			}
+			open = append(kept, run)
+		}
+	}
+	windows = append(windows, open...)
+
+	// growing windows can end up overlapping ones finished earlier
+	for merged := true; merged; {
+		merged = false
+		for i := 0; i < len(windows) && !merged; i++ {
+			for j := i + 1; j < len(windows); j++ {
+				if windows[i].Overlaps(windows[j]) {
+					windows[i] = windows[i].Union(windows[j])
+					windows = append(windows[:j], windows[j+1:]...)
+					merged = true
+					break
+				}
+			}
+		}
+	}
+	sort.Slice(windows, func(i, j int) bool {
+		if windows[i].Min.Y != windows[j].Min.Y {
+			return windows[i].Min.Y < windows[j].Min.Y
+		}
+		return windows[i].Min.X < windows[j].Min.X
+	})
+	return windows
+}
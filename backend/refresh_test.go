@@ -0,0 +1,116 @@
+package main
+
+import (
+	"image"
+	"testing"
+)
+
+// drawnFrame is a white screen already on the panel, cleared ready for the
+// next frame the way Dashboard.Update does
+func drawnFrame() *Screen {
+	screen := NewScreen(800, 480)
+	screen.Clear()
+	screen.SetPrevious(screen.OneBitImage(), 0)
+	screen.Clear()
+	return screen
+}
+
+var refreshPolicy = RefreshPolicy{FullEvery: 10, MaxArea: 0.5}
+
+func TestRefreshSeparateChanges(t *testing.T) {
+	screen := drawnFrame()
+	screen.DrawRect(0, 0, 16, 4, image.Black)
+	screen.DrawRect(784, 476, 800, 480, image.Black)
+	refresh := screen.Refresh(refreshPolicy)
+	if refresh.Full {
+		t.Fatal("full refresh for two small changes")
+	}
+	want := []image.Rectangle{image.Rect(0, 0, 16, 4), image.Rect(784, 476, 800, 480)}
+	if len(refresh.Windows) != len(want) {
+		t.Fatalf("got windows %v, want %v", refresh.Windows, want)
+	}
+	for i, w := range want {
+		if refresh.Windows[i] != w {
+			t.Errorf("window %d is %v, want %v", i, refresh.Windows[i], w)
+		}
+	}
+}
+
+func TestRefreshNearbyChanges(t *testing.T) {
+	screen := drawnFrame()
+	// close enough to go in one window, like the letters of a word
+	screen.DrawRect(100, 100, 110, 110, image.Black)
+	screen.DrawRect(120, 112, 130, 120, image.Black)
+	// and one further off in the same rows
+	screen.DrawRect(400, 100, 410, 110, image.Black)
+	refresh := screen.Refresh(refreshPolicy)
+	want := []image.Rectangle{image.Rect(96, 100, 136, 120), image.Rect(400, 100, 416, 110)}
+	if len(refresh.Windows) != len(want) {
+		t.Fatalf("got windows %v, want %v", refresh.Windows, want)
+	}
+	for i, w := range want {
+		if refresh.Windows[i] != w {
+			t.Errorf("window %d is %v, want %v", i, refresh.Windows[i], w)
+		}
+	}
+}
+
+func TestRefreshJoinedBelow(t *testing.T) {
+	screen := drawnFrame()
+	// a U shape, the arms start as separate windows and are joined by the
+	// bottom
+	screen.DrawRect(0, 0, 8, 50, image.Black)
+	screen.DrawRect(200, 0, 208, 50, image.Black)
+	screen.DrawRect(0, 50, 208, 52, image.Black)
+	refresh := screen.Refresh(refreshPolicy)
+	if len(refresh.Windows) != 1 || refresh.Windows[0] != image.Rect(0, 0, 208, 52) {
+		t.Errorf("got windows %v", refresh.Windows)
+	}
+}
+
+func TestRefreshUnchanged(t *testing.T) {
+	screen := drawnFrame()
+	screen.DrawRect(10, 10, 20, 20, image.White)
+	refresh := screen.Refresh(refreshPolicy)
+	if refresh.Full || len(refresh.Windows) != 0 {
+		t.Errorf("got %v full %v for an unchanged frame", refresh.Windows, refresh.Full)
+	}
+	if screen.Partials != 0 {
+		t.Errorf("counted %d partial refreshes", screen.Partials)
+	}
+}
+
+func TestRefreshPolicy(t *testing.T) {
+	screen := NewScreen(800, 480)
+	if refresh := screen.Refresh(refreshPolicy); !refresh.Full {
+		t.Error("first frame not a full refresh")
+	}
+
+	screen = drawnFrame()
+	screen.DrawRect(0, 0, 800, 300, image.Black)
+	if refresh := screen.Refresh(refreshPolicy); !refresh.Full {
+		t.Error("partial refresh of most of the screen")
+	}
+
+	screen = drawnFrame()
+	screen.Partials = refreshPolicy.FullEvery
+	screen.DrawRect(0, 0, 8, 8, image.Black)
+	refresh := screen.Refresh(refreshPolicy)
+	if !refresh.Full || screen.Partials != 0 {
+		t.Errorf("full %v with %d partials, want a full refresh", refresh.Full, screen.Partials)
+	}
+}
+
+func TestRefreshRedrawn(t *testing.T) {
+	screen := drawnFrame()
+	screen.DrawRect(100, 100, 200, 120, image.Black)
+	screen.Refresh(refreshPolicy)
+	// the whole frame is drawn again, only what differs is refreshed
+	screen.Clear()
+	screen.DrawRect(100, 100, 200, 120, image.Black)
+	screen.DrawRect(304, 300, 312, 308, image.Black)
+	refresh := screen.Refresh(refreshPolicy)
+	if refresh.Full || len(refresh.Windows) != 1 || refresh.Windows[0] != image.Rect(304, 300, 312, 308) {
+		t.Errorf("got %v full %v, want the new square", refresh.Windows, refresh.Full)
+	}
+}
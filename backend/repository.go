@@ -0,0 +1,333 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// prices are stored in UTC+0200 whatever the time of year
+var priceZone = time.FixedZone("", 2*60*60)
+
+const priceFormat = "2006-01-02T15:04:05-0700"
+
+// usageFormat is how times are stored in the useage table
+const usageFormat = "2006-01-02T15:04:05.000Z"
+
+// PriceInterval is the price for a period of time in DKK/kWh
+type PriceInterval struct {
+	Start time.Time
+	End   time.Time
+	Price float64
+}
+
+// Reading is the electricity used over a period, in kWh. Exported is what
+// was fed into the grid over the same period
+type Reading struct {
+	Start    time.Time
+	End      time.Time
+	Amount   float64
+	Exported float64
+}
+
+// migrations create the schema, each one is run once in order and the
+// number run so far is kept in the database's user_version
+var migrations = []string{
+	`create table if not exists prices (price text, start text, end text);
+	 create table if not exists useage (amount text, start text, end text);
+	 create index if not exists prices_start on prices (start);
+	 create index if not exists prices_end on prices (end);
+	 create index if not exists useage_start on useage (start);
+	 create index if not exists useage_end on useage (end);`,
+	`alter table useage add column exported text not null default '0';
+	 create table production (amount text, start text, end text);
+	 create index production_start on production (start);
+	 create index production_end on production (end);`,
+	`create table emissions (intensity text, start text, end text, prognosis integer);
+	 create index emissions_start on emissions (start);
+	 create index emissions_end on emissions (end);`,
+	`create table shifting (day text primary key, amount text, cost text, average text, optimal text, cheap text);`,
+	`create table notifications (key text primary key, sent text);`,
+	`alter table useage add column meter text not null default 'main';
+	 create index useage_meter_start on useage (meter, start);`,
+}
+
+// Migrate brings the database schema up to date
+func (power *Power) Migrate() error {
+	var version int
+	err := power.Db.QueryRow("pragma user_version").Scan(&version)
+	if err != nil {
+		return err
+	}
+	for ; version < len(migrations); version++ {
+		tx, err := power.Db.Begin()
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(migrations[version])
+		if err == nil {
+			// pragmas cannot take parameters
+			_, err = tx.Exec(fmt.Sprintf("pragma user_version = %d", version+1))
+		}
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", version+1, err)
+		}
+		err = tx.Commit()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PriceAt returns the price interval covering t
+func (power *Power) PriceAt(t time.Time) (PriceInterval, error) {
+	at := t.In(priceZone).Format(priceFormat)
+	query := "select price, start, end from prices where start <= $1 and end > $1 order by start desc limit 1"
+	prices, err := power.queryPrices(query, at)
+	if err != nil {
+		return PriceInterval{}, err
+	}
+	if len(prices) == 0 {
+		return PriceInterval{}, fmt.Errorf("%w for %s", ErrNoPrice, t)
+	}
+	return prices[0], nil
+}
+
+// PricesBetween returns the price intervals overlapping start until end,
+// in order
+func (power *Power) PricesBetween(start, end time.Time) ([]PriceInterval, error) {
+	query := "select price, start, end from prices where start < $1 and end > $2 order by start"
+	return power.queryPrices(query, end.In(priceZone).Format(priceFormat), start.In(priceZone).Format(priceFormat))
+}
+
+func (power *Power) queryPrices(query string, args ...interface{}) ([]PriceInterval, error) {
+	rows, err := power.Db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var prices []PriceInterval
+	for rows.Next() {
+		var price, start, end string
+		err = rows.Scan(&price, &start, &end)
+		if err != nil {
+			return nil, err
+		}
+		var p PriceInterval
+		p.Price, err = strconv.ParseFloat(price, 64)
+		if err != nil {
+			return nil, fmt.Errorf("price from %s: %w", start, err)
+		}
+		p.Start, err = time.Parse(priceFormat, start)
+		if err != nil {
+			return nil, err
+		}
+		p.End, err = time.Parse(priceFormat, end)
+		if err != nil {
+			return nil, err
+		}
+		prices = append(prices, p)
+	}
+	return prices, rows.Err()
+}
+
+// UsageBetween returns the main meter's readings that fall within start
+// until end, in order
+func (power *Power) UsageBetween(start, end time.Time) ([]Reading, error) {
+	return power.MeterUsageBetween(MainMeter, start, end)
+}
+
+// MeterUsageBetween returns a meter's readings that fall within start until
+// end, in order. The remainder is worked out from the others
+func (power *Power) MeterUsageBetween(meter string, start, end time.Time) ([]Reading, error) {
+	if meter == RemainderMeter {
+		return power.remainderBetween(start, end)
+	}
+	query := "select amount, exported, start, end from useage where start >= $1 and end <= $2 and meter = $3 order by start"
+	return power.queryReadings(query, start, end, meter)
+}
+
+// ProductionBetween returns the solar production readings that fall within
+// start until end, in order
+func (power *Power) ProductionBetween(start, end time.Time) ([]Reading, error) {
+	query := "select amount, '0', start, end from production where start >= $1 and end <= $2 order by start"
+	return power.queryReadings(query, start, end)
+}
+
+func (power *Power) queryReadings(query string, start, end time.Time, args ...interface{}) ([]Reading, error) {
+	args = append([]interface{}{start.UTC().Format(usageFormat), end.UTC().Format(usageFormat)}, args...)
+	rows, err := power.Db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var readings []Reading
+	for rows.Next() {
+		var amount, exported, from, to string
+		err = rows.Scan(&amount, &exported, &from, &to)
+		if err != nil {
+			return nil, err
+		}
+		var r Reading
+		r.Amount, err = strconv.ParseFloat(amount, 64)
+		if err != nil {
+			return nil, fmt.Errorf("usage from %s: %w", from, err)
+		}
+		r.Exported, err = strconv.ParseFloat(exported, 64)
+		if err != nil {
+			return nil, fmt.Errorf("export from %s: %w", from, err)
+		}
+		r.Start, err = time.Parse(usageFormat, from)
+		if err != nil {
+			return nil, err
+		}
+		r.End, err = time.Parse(usageFormat, to)
+		if err != nil {
+			return nil, err
+		}
+		readings = append(readings, r)
+	}
+	return readings, rows.Err()
+}
+
+// LatestUsage returns the end of the main meter's last reading stored
+func (power *Power) LatestUsage() (time.Time, error) {
+	var end sql.NullString
+	err := power.Db.QueryRow("select max(end) from useage where meter = $1", MainMeter).Scan(&end)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !end.Valid {
+		return time.Time{}, errors.New("no usage stored")
+	}
+	return time.Parse(usageFormat, end.String)
+}
+
+// StorePrices writes prices into the prices table, replacing any already
+// there for the same start
+func (power *Power) StorePrices(prices []PriceInterval) error {
+	tx, err := power.Db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, p := range prices {
+		start := p.Start.In(priceZone).Format(priceFormat)
+		_, err = tx.Exec("delete from prices where start = $1", start)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		_, err = tx.Exec("insert into prices (price, start, end) values ($1, $2, $3)",
+			fmt.Sprintf("%f", p.Price), start, p.End.In(priceZone).Format(priceFormat))
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// dedupeReadings sorts the readings and drops any that overlap an earlier
+// one, so the first reading for a period wins
+func dedupeReadings(readings []Reading) []Reading {
+	sort.SliceStable(readings, func(i, j int) bool {
+		return readings[i].Start.Before(readings[j].Start)
+	})
+	var out []Reading
+	for _, r := range readings {
+		if !r.End.After(r.Start) {
+			continue
+		}
+		if len(out) > 0 && r.Start.Before(out[len(out)-1].End) {
+			continue
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+// StoreUsage writes the main meter's readings into the useage table,
+// replacing any already stored readings that overlap them
+func (power *Power) StoreUsage(readings []Reading) error {
+	return power.StoreMeterUsage(MainMeter, readings)
+}
+
+// StoreMissingUsage writes the main meter's readings into the useage table
+// where none are stored for their time yet. The meter's own hours are only a
+// stand-in until Eloverblik has the metered ones, which replace them
+func (power *Power) StoreMissingUsage(readings []Reading) error {
+	tx, err := power.Db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, r := range dedupeReadings(readings) {
+		start := r.Start.UTC().Format(usageFormat)
+		end := r.End.UTC().Format(usageFormat)
+		var stored int
+		err = tx.QueryRow("select count(*) from useage where start < $1 and end > $2 and meter = $3", end, start, MainMeter).Scan(&stored)
+		if err == nil && stored == 0 {
+			_, err = tx.Exec("insert into useage (amount, exported, start, end, meter) values ($1, $2, $3, $4, $5)",
+				strconv.FormatFloat(r.Amount, 'f', -1, 64), strconv.FormatFloat(r.Exported, 'f', -1, 64), start, end, MainMeter)
+		}
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// StoreMeterUsage writes a meter's readings into the useage table,
+// replacing any of its stored readings that overlap them
+func (power *Power) StoreMeterUsage(meter string, readings []Reading) error {
+	if meter == RemainderMeter {
+		return errors.New("the remainder cannot be stored")
+	}
+	return power.storeReadings("useage", meter, readings)
+}
+
+// StoreProduction writes solar production readings into the production
+// table, replacing any already stored readings that overlap them
+func (power *Power) StoreProduction(readings []Reading) error {
+	return power.storeReadings("production", "", readings)
+}
+
+// storeReadings writes readings into the production or useage table, under
+// meter for usage
+func (power *Power) storeReadings(table, meter string, readings []Reading) error {
+	readings = dedupeReadings(readings)
+	tx, err := power.Db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, r := range readings {
+		start := r.Start.UTC().Format(usageFormat)
+		end := r.End.UTC().Format(usageFormat)
+		if table == "production" {
+			_, err = tx.Exec("delete from production where start < $1 and end > $2", end, start)
+		} else {
+			_, err = tx.Exec("delete from useage where start < $1 and end > $2 and meter = $3", end, start, meter)
+		}
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		amount := strconv.FormatFloat(r.Amount, 'f', -1, 64)
+		if table == "production" {
+			_, err = tx.Exec("insert into production (amount, start, end) values ($1, $2, $3)", amount, start, end)
+		} else {
+			_, err = tx.Exec("insert into useage (amount, exported, start, end, meter) values ($1, $2, $3, $4, $5)",
+				amount, strconv.FormatFloat(r.Exported, 'f', -1, 64), start, end, meter)
+		}
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
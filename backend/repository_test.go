@@ -0,0 +1,121 @@
+package main
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDedupeReadings(t *testing.T) {
+	at := func(hour, min int) time.Time {
+		return time.Date(2026, 1, 17, hour, min, 0, 0, time.UTC)
+	}
+	readings := []Reading{
+		{Start: at(2, 0), End: at(3, 0), Amount: 3},
+		{Start: at(0, 0), End: at(1, 0), Amount: 1},
+		// the same hour from a second file
+		{Start: at(0, 0), End: at(1, 0), Amount: 10},
+		// quarter hours inside an hour already read
+		{Start: at(0, 30), End: at(0, 45), Amount: 0.2},
+		// overlapping the end of the first hour
+		{Start: at(0, 45), End: at(1, 45), Amount: 0.5},
+		{Start: at(1, 0), End: at(2, 0), Amount: 2},
+		// empty
+		{Start: at(3, 0), End: at(3, 0), Amount: 4},
+		{Start: at(3, 0), End: at(4, 0), Amount: 5},
+	}
+	want := []Reading{
+		{Start: at(0, 0), End: at(1, 0), Amount: 1},
+		{Start: at(1, 0), End: at(2, 0), Amount: 2},
+		{Start: at(2, 0), End: at(3, 0), Amount: 3},
+		{Start: at(3, 0), End: at(4, 0), Amount: 5},
+	}
+	checkReadings(t, dedupeReadings(readings), want)
+}
+
+func TestStoreMissingUsage(t *testing.T) {
+	power := testPower(t, time.UTC)
+	at := func(hour int) time.Time {
+		return time.Date(2026, 1, 17, hour, 0, 0, 0, time.UTC)
+	}
+	check := func(want []Reading) {
+		t.Helper()
+		readings, err := power.UsageBetween(at(0), at(24))
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkReadings(t, readings, want)
+	}
+	imported := []Reading{{Start: at(10), End: at(11), Amount: 1}, {Start: at(11), End: at(12), Amount: 2}}
+	if err := power.StoreUsage(imported); err != nil {
+		t.Fatal(err)
+	}
+	// the meter's hours are only stored where nothing was imported
+	err := power.StoreMissingUsage([]Reading{
+		{Start: at(11), End: at(12), Amount: 2.1},
+		{Start: at(12), End: at(13), Amount: 3.1},
+		{Start: at(13), End: at(15), Amount: 4.1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check([]Reading{imported[0], imported[1], {Start: at(12), End: at(13), Amount: 3.1}, {Start: at(13), End: at(15), Amount: 4.1}})
+
+	// and then replaced by the imported ones
+	if err = power.StoreUsage([]Reading{{Start: at(12), End: at(13), Amount: 3}, {Start: at(13), End: at(14), Amount: 4}}); err != nil {
+		t.Fatal(err)
+	}
+	check([]Reading{imported[0], imported[1], {Start: at(12), End: at(13), Amount: 3}, {Start: at(13), End: at(14), Amount: 4}})
+}
+
+func TestMigrate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the tables as they were before there were migrations
+	_, err = db.Exec(`create table prices (price text, start text, end text);
+		create table useage (amount text, start text, end text);
+		insert into useage (amount, start, end) values ('1.5', '2026-01-17T10:00:00.000Z', '2026-01-17T11:00:00.000Z');`)
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2026, 1, 17, 10, 0, 0, 0, time.UTC)
+	check := func(power *Power) {
+		t.Helper()
+		var version int
+		if err := power.Db.QueryRow("pragma user_version").Scan(&version); err != nil {
+			t.Fatal(err)
+		}
+		if version != len(migrations) {
+			t.Errorf("schema version %d, want %d", version, len(migrations))
+		}
+		readings, err := power.UsageBetween(start, start.Add(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkReadings(t, readings, []Reading{{Start: start, End: start.Add(time.Hour), Amount: 1.5}})
+	}
+
+	power, err := NewPower(path, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(power)
+	// once up to date nothing is run again
+	if err = power.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	check(power)
+	power.Db.Close()
+
+	power, err = NewPower(path, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer power.Db.Close()
+	check(power)
+}
@@ -1,10 +1,11 @@
 package main
 
 import (
+	"fmt"
 	"image"
+	"image/color"
 	"image/draw"
 	"io/ioutil"
-	"log"
 
 	"github.com/golang/freetype/truetype"
 	"golang.org/x/image/font"
@@ -15,6 +16,10 @@ type Screen struct {
 	Font          *truetype.Font
 	Image         *image.Gray
 	Width, Height int
+	// Partials is the number of partial refreshes since the last full one
+	Partials int
+	// previous is the last frame refreshed, in OneBitImage format
+	previous []byte
 }
 
 func NewScreen(width, height int) *Screen {
@@ -26,16 +31,17 @@ func NewScreen(width, height int) *Screen {
 	return screen
 }
 
-func (screen *Screen) LoadFont(path string) {
+func (screen *Screen) LoadFont(path string) error {
 	ttf, err := ioutil.ReadFile(path)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
 	screen.Font, err = truetype.Parse(ttf)
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("loading font %s: %w", path, err)
 	}
+	return nil
 }
 
 func (screen *Screen) LargeFace() font.Face {
@@ -78,8 +84,38 @@ func (screen *Screen) Write(text string, x, y int, black, large bool) {
 	d.DrawString(text)
 }
 
+// TextWidth is how wide text is when written
+func (screen *Screen) TextWidth(text string, large bool) int {
+	face := screen.Face()
+	if large {
+		face = screen.LargeFace()
+	}
+	return font.MeasureString(face, text).Round()
+}
+
 func (screen *Screen) DrawRect(x1, y1, x2, y2 int, colour *image.Uniform) {
-	draw.Draw(screen.Image, image.Rect(x1, y1, x2, y2), colour, image.Point{}, draw.Src)
+	r := image.Rect(x1, y1, x2, y2)
+	draw.Draw(screen.Image, r, colour, image.Point{}, draw.Src)
+}
+
+// DrawPattern fills a rectangle, making the points pattern returns true for
+// black and the rest white
+func (screen *Screen) DrawPattern(x1, y1, x2, y2 int, pattern func(x, y int) bool) {
+	r := image.Rect(x1, y1, x2, y2).Intersect(screen.Image.Bounds())
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			colour := color.Gray{Y: 0xff}
+			if pattern(x, y) {
+				colour.Y = 0
+			}
+			screen.Image.SetGray(x, y, colour)
+		}
+	}
+}
+
+// Clear blanks the whole screen ready to draw the next frame
+func (screen *Screen) Clear() {
+	screen.DrawRect(0, 0, screen.Width, screen.Height, image.White)
 }
 
 func (screen *Screen) DrawHorizontalLine(height, start, length int) {
@@ -134,7 +170,7 @@ func (screen *Screen) OneBitImage() []byte {
 			var b byte
 			b = 0
 			for i := 0; i < 8; i++ {
-				pos := y*800 + x + i
+				pos := y*screen.Image.Stride + x + i
 				if screen.Image.Pix[pos] > 127 {
 					b |= (1 << (7 - i))
 				} else {
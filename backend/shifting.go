@@ -0,0 +1,256 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Shifting is how well electricity use was moved to the cheap hours of a
+// day, or of several days added up. Costs are in DKK
+type Shifting struct {
+	// Day is the local midnight the day starts at, the first day for totals
+	Day time.Time
+	// Amount is the kWh used at a known price and Cost what it cost
+	Amount float64
+	Cost   float64
+	// AverageCost is what Amount would have cost at the day's average price
+	AverageCost float64
+	// OptimalCost is the cost had the day's use been moved into its
+	// cheapest hours, no hour using more than the day's busiest one did
+	OptimalCost float64
+	// CheapAmount is the kWh used in the cheapest third of the day
+	CheapAmount float64
+}
+
+// shiftingWeeks is how far back the history is filled in the first time
+const shiftingWeeks = 12
+
+// Score is how much of the possible saving on the average price was made,
+// 100 for the optimal schedule and below zero for worse than average. It is
+// false when there was nothing to gain, e.g. with flat prices
+func (s Shifting) Score() (float64, bool) {
+	possible := s.AverageCost - s.OptimalCost
+	if possible < 0.0001 {
+		return 0, false
+	}
+	return (s.AverageCost - s.Cost) / possible * 100, true
+}
+
+// CheapShare is the percentage of the kWh used in the cheapest third of the
+// day
+func (s Shifting) CheapShare() float64 {
+	if s.Amount == 0 {
+		return 0
+	}
+	return s.CheapAmount / s.Amount * 100
+}
+
+// add adds another day onto a total
+func (s *Shifting) add(o Shifting) {
+	if s.Day.IsZero() || o.Day.Before(s.Day) {
+		s.Day = o.Day
+	}
+	s.Amount += o.Amount
+	s.Cost += o.Cost
+	s.AverageCost += o.AverageCost
+	s.OptimalCost += o.OptimalCost
+	s.CheapAmount += o.CheapAmount
+}
+
+// totalShifting adds up days
+func totalShifting(days []Shifting) Shifting {
+	var total Shifting
+	for _, d := range days {
+		total.add(d)
+	}
+	return total
+}
+
+// slot is a reading along with the price paid for it in DKK/kWh
+type slot struct {
+	Reading
+	price float64
+}
+
+// analyseShifting works out the shifting for each local day of sorted
+// readings, costed at sorted consumer prices. Readings without a price are
+// left out
+func analyseShifting(readings []Reading, prices []PriceInterval, loc *time.Location) []Shifting {
+	var days []Shifting
+	var slots []slot
+	day := time.Time{}
+	first := 0
+	for _, r := range readings {
+		local := r.Start.In(loc)
+		midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+		if !midnight.Equal(day) {
+			if len(slots) > 0 {
+				days = append(days, shiftDay(day, slots))
+			}
+			day, slots = midnight, nil
+		}
+		// both are in order, so the prices before this reading are done with
+		for first < len(prices) && !prices[first].End.After(r.Start) {
+			first++
+		}
+		last := first
+		for last < len(prices) && prices[last].Start.Before(r.End) {
+			last++
+		}
+		price, err := averagePrice(prices[first:last], r.Start, r.End)
+		if err != nil {
+			continue
+		}
+		slots = append(slots, slot{Reading: r, price: price / 100})
+	}
+	if len(slots) > 0 {
+		days = append(days, shiftDay(day, slots))
+	}
+	return days
+}
+
+// shiftDay compares a day's use with the average price and with the best
+// schedule for it
+func shiftDay(day time.Time, slots []slot) Shifting {
+	s := Shifting{Day: day}
+	var length time.Duration
+	priceSum, peak := 0.0, 0.0
+	for _, sl := range slots {
+		hours := sl.End.Sub(sl.Start).Hours()
+		s.Amount += sl.Amount
+		s.Cost += sl.Amount * sl.price
+		length += sl.End.Sub(sl.Start)
+		priceSum += sl.price * hours
+		if rate := sl.Amount / hours; rate > peak {
+			peak = rate
+		}
+	}
+	s.AverageCost = s.Amount * priceSum / length.Hours()
+
+	sort.SliceStable(slots, func(i, j int) bool {
+		return slots[i].price < slots[j].price
+	})
+	var cheap time.Duration
+	left := s.Amount
+	for _, sl := range slots {
+		if cheap < length/3 {
+			s.CheapAmount += sl.Amount
+			cheap += sl.End.Sub(sl.Start)
+		}
+		placed := peak * sl.End.Sub(sl.Start).Hours()
+		if placed > left {
+			placed = left
+		}
+		s.OptimalCost += placed * sl.price
+		left -= placed
+	}
+	return s
+}
+
+// UpdateShifting stores the shifting of the complete days with readings
+// since a week before the last day stored, so late readings are picked up
+func (power *Power) UpdateShifting(now time.Time) error {
+	from := now.AddDate(0, 0, -7*shiftingWeeks)
+	var last sql.NullString
+	err := power.Db.QueryRow("select max(day) from shifting").Scan(&last)
+	if err != nil {
+		return err
+	}
+	if last.Valid {
+		day, err := time.ParseInLocation("2006-01-02", last.String, power.Location)
+		if err != nil {
+			return err
+		}
+		if day.AddDate(0, 0, -7).After(from) {
+			from = day.AddDate(0, 0, -7)
+		}
+	}
+	from = from.In(power.Location)
+	from = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, power.Location)
+
+	readings, err := power.UsageBetween(from, now)
+	if err != nil {
+		return err
+	}
+	prices, err := power.PricesBetween(from, now)
+	if err != nil {
+		return err
+	}
+	// only days with readings all the way through are stored
+	covered := make(map[time.Time]time.Duration)
+	for _, r := range readings {
+		local := r.Start.In(power.Location)
+		covered[time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, power.Location)] += r.End.Sub(r.Start)
+	}
+	var days []Shifting
+	for _, d := range analyseShifting(readings, power.consumerPrices(prices), power.Location) {
+		if covered[d.Day] >= d.Day.AddDate(0, 0, 1).Sub(d.Day) {
+			days = append(days, d)
+		}
+	}
+	return power.StoreShifting(days)
+}
+
+// StoreShifting writes days into the shifting table, replacing any already
+// there for the same day
+func (power *Power) StoreShifting(days []Shifting) error {
+	tx, err := power.Db.Begin()
+	if err != nil {
+		return err
+	}
+	format := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	for _, d := range days {
+		day := d.Day.In(power.Location).Format("2006-01-02")
+		_, err = tx.Exec("delete from shifting where day = $1", day)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		_, err = tx.Exec("insert into shifting (day, amount, cost, average, optimal, cheap) values ($1, $2, $3, $4, $5, $6)",
+			day, format(d.Amount), format(d.Cost), format(d.AverageCost), format(d.OptimalCost), format(d.CheapAmount))
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ShiftingHistory returns the stored days from the local day start is in
+// until the one end is in, in order
+func (power *Power) ShiftingHistory(start, end time.Time) ([]Shifting, error) {
+	query := "select day, amount, cost, average, optimal, cheap from shifting where day >= $1 and day < $2 order by day"
+	rows, err := power.Db.Query(query, start.In(power.Location).Format("2006-01-02"), end.In(power.Location).Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var days []Shifting
+	for rows.Next() {
+		var day string
+		var values [5]string
+		err = rows.Scan(&day, &values[0], &values[1], &values[2], &values[3], &values[4])
+		if err != nil {
+			return nil, err
+		}
+		var d Shifting
+		d.Day, err = time.ParseInLocation("2006-01-02", day, power.Location)
+		if err != nil {
+			return nil, err
+		}
+		fields := []*float64{&d.Amount, &d.Cost, &d.AverageCost, &d.OptimalCost, &d.CheapAmount}
+		for i, v := range values {
+			*fields[i], err = strconv.ParseFloat(v, 64)
+			if err != nil {
+				return nil, fmt.Errorf("shifting on %s: %w", day, err)
+			}
+		}
+		days = append(days, d)
+	}
+	return days, rows.Err()
+}
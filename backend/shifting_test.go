@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestShiftDay(t *testing.T) {
+	day := time.Date(2026, 1, 18, 0, 0, 0, 0, time.UTC)
+	// three hours priced 1, 2 and 3 DKK/kWh unless flat
+	slots := func(prices []float64, amounts ...float64) []slot {
+		var slots []slot
+		for i, amount := range amounts {
+			start := day.Add(time.Duration(i) * time.Hour)
+			slots = append(slots, slot{Reading: Reading{Start: start, End: start.Add(time.Hour), Amount: amount}, price: prices[i]})
+		}
+		return slots
+	}
+	rising := []float64{1, 2, 3}
+	tests := []struct {
+		name       string
+		slots      []slot
+		cost       float64
+		score      float64
+		scored     bool
+		cheapShare float64
+	}{
+		{"best schedule", slots(rising, 2, 1, 0), 4, 100, true, 200.0 / 3},
+		{"half way", slots(rising, 1, 2, 0), 5, 50, true, 100.0 / 3},
+		{"average", slots(rising, 1, 0, 1), 4, 0, true, 50},
+		{"worse than average", slots(rising, 0, 1, 2), 8, -100, true, 0},
+		// the same every hour cannot be moved without using more in an hour
+		{"even use", slots(rising, 1, 1, 1), 6, 0, false, 100.0 / 3},
+		{"flat prices", slots([]float64{2, 2, 2}, 2, 1, 0), 6, 0, false, 200.0 / 3},
+	}
+	for _, test := range tests {
+		s := shiftDay(day, test.slots)
+		if !s.Day.Equal(day) || !near(s.Cost, test.cost) || !near(s.CheapShare(), test.cheapShare) {
+			t.Errorf("%s: got %+v, want a cost of %.2f and %.1f%% cheap", test.name, s, test.cost, test.cheapShare)
+		}
+		score, ok := s.Score()
+		if ok != test.scored || ok && !near(score, test.score) {
+			t.Errorf("%s: got a score of %.1f, %t, want %.1f, %t", test.name, score, ok, test.score, test.scored)
+		}
+	}
+
+	if _, ok := (Shifting{}).Score(); ok {
+		t.Error("a day without use is scored")
+	}
+}
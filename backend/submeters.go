@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+// Meters readings are stored under. Sub-meters go by the names they are
+// given in the config
+const (
+	// MainMeter is the grid connection, everything the house uses
+	MainMeter = "main"
+	// RemainderMeter is not stored but worked out as the main meter less
+	// the sub-meters, the use nothing else measures
+	RemainderMeter = "remainder"
+)
+
+// SubMeter is a meter measuring part of what the main meter does, e.g. a
+// heat pump or an EV charger
+type SubMeter struct {
+	// Name is what its readings are stored and shown under
+	Name string
+	// MeteringPoint is its metering point on Eloverblik, when empty its
+	// readings are only imported from files
+	MeteringPoint string
+}
+
+// MeterDay is the kWh each meter used over a local day
+type MeterDay struct {
+	Day time.Time
+	// Amounts are by meter, the sub-meters and the remainder
+	Amounts map[string]float64
+}
+
+// Meters returns the meters the main one is split into, the sub-meters and
+// then the remainder. It is empty without sub-meters
+func (power *Power) Meters() []string {
+	if len(power.SubMeters) == 0 {
+		return nil
+	}
+	return append(append([]string(nil), power.SubMeters...), RemainderMeter)
+}
+
+// remainderBetween is the main meter's readings within start until end with
+// the sub-meters' taken off. Export is left with the main meter
+func (power *Power) remainderBetween(start, end time.Time) ([]Reading, error) {
+	readings, err := power.MeterUsageBetween(MainMeter, start, end)
+	if err != nil {
+		return nil, err
+	}
+	for i := range readings {
+		readings[i].Exported = 0
+	}
+	for _, meter := range power.SubMeters {
+		sub, err := power.MeterUsageBetween(meter, start, end)
+		if err != nil {
+			return nil, err
+		}
+		subtractReadings(readings, sub)
+	}
+	return readings, nil
+}
+
+// subtractReadings takes sub off readings, both sorted. Each sub reading is
+// spread over the readings it overlaps by time, so the two do not have to
+// be taken at the same interval. Readings never go below zero, which they
+// could when the meters disagree a little
+func subtractReadings(readings, sub []Reading) {
+	first := 0
+	for _, s := range sub {
+		length := s.End.Sub(s.Start)
+		if length <= 0 {
+			continue
+		}
+		for first < len(readings) && !readings[first].End.After(s.Start) {
+			first++
+		}
+		for i := first; i < len(readings) && readings[i].Start.Before(s.End); i++ {
+			from, to := readings[i].Start, readings[i].End
+			if from.Before(s.Start) {
+				from = s.Start
+			}
+			if to.After(s.End) {
+				to = s.End
+			}
+			readings[i].Amount -= s.Amount * float64(to.Sub(from)) / float64(length)
+		}
+	}
+	for i := range readings {
+		if readings[i].Amount < 0 {
+			readings[i].Amount = 0
+		}
+	}
+}
+
+// MeterDays adds up each meter's use by local day from start until end, for
+// the days the main meter has readings
+func (power *Power) MeterDays(start, end time.Time) ([]MeterDay, error) {
+	meters := power.Meters()
+	if len(meters) == 0 {
+		return nil, errors.New("no sub-meters configured")
+	}
+	main, err := power.MeterUsageBetween(MainMeter, start, end)
+	if err != nil {
+		return nil, err
+	}
+	var days []MeterDay
+	index := make(map[time.Time]int)
+	for _, r := range main {
+		day := power.localDay(r.Start)
+		if _, ok := index[day]; !ok {
+			index[day] = len(days)
+			days = append(days, MeterDay{Day: day, Amounts: make(map[string]float64)})
+		}
+	}
+	for _, meter := range meters {
+		readings, err := power.MeterUsageBetween(meter, start, end)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range readings {
+			if i, ok := index[power.localDay(r.Start)]; ok {
+				days[i].Amounts[meter] += r.Amount
+			}
+		}
+	}
+	return days, nil
+}
+
+// localDay is the local midnight the day t is in starts at
+func (power *Power) localDay(t time.Time) time.Time {
+	local := t.In(power.Location)
+	return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, power.Location)
+}
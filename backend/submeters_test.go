@@ -0,0 +1,97 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSubtractReadings(t *testing.T) {
+	at := func(hour, min int) time.Time {
+		return time.Date(2026, 1, 18, hour, min, 0, 0, time.UTC)
+	}
+	reading := func(hour, min int, length time.Duration, amount float64) Reading {
+		return Reading{Start: at(hour, min), End: at(hour, min).Add(length), Amount: amount}
+	}
+	hourly := []Reading{reading(0, 0, time.Hour, 2), reading(1, 0, time.Hour, 3)}
+	tests := []struct {
+		name     string
+		readings []Reading
+		sub      []Reading
+		want     []float64
+	}{
+		{"same hours", hourly, []Reading{reading(0, 0, time.Hour, 0.5), reading(1, 0, time.Hour, 1)}, []float64{1.5, 2}},
+		{"quarter hours off hours", hourly, []Reading{
+			reading(0, 0, 15*time.Minute, 0.25), reading(0, 15, 15*time.Minute, 0.25),
+			reading(0, 30, 15*time.Minute, 0.25), reading(0, 45, 15*time.Minute, 0.25),
+		}, []float64{1, 3}},
+		{"an hour off quarter hours", []Reading{
+			reading(0, 0, 15*time.Minute, 0.5), reading(0, 15, 15*time.Minute, 0.5),
+			reading(0, 30, 15*time.Minute, 0.5), reading(0, 45, 15*time.Minute, 0.5),
+		}, []Reading{reading(0, 0, time.Hour, 1)}, []float64{0.25, 0.25, 0.25, 0.25}},
+		{"across two hours", hourly, []Reading{reading(0, 30, time.Hour, 1)}, []float64{1.5, 2.5}},
+		{"more than used", hourly, []Reading{reading(0, 0, time.Hour, 2.5)}, []float64{0, 3}},
+		{"outside the readings", hourly, []Reading{reading(5, 0, time.Hour, 1)}, []float64{2, 3}},
+		{"no length", hourly, []Reading{reading(0, 0, 0, 1)}, []float64{2, 3}},
+	}
+	for _, test := range tests {
+		readings := append([]Reading(nil), test.readings...)
+		subtractReadings(readings, test.sub)
+		for i, r := range readings {
+			if !near(r.Amount, test.want[i]) {
+				t.Errorf("%s: got %v, want %v", test.name, readings, test.want)
+				break
+			}
+		}
+	}
+}
+
+func TestMeterDays(t *testing.T) {
+	loc := copenhagen(t)
+	power := testPower(t, loc)
+	if _, err := power.MeterDays(time.Now().AddDate(0, 0, -7), time.Now()); err == nil {
+		t.Error("no error without sub-meters")
+	}
+
+	power.SubMeters = []string{"heat pump", "car"}
+	at := func(day, hour int) time.Time {
+		return time.Date(2026, 1, day, hour, 0, 0, 0, loc)
+	}
+	store := func(meter string, start, end time.Time, amount float64) {
+		t.Helper()
+		var readings []Reading
+		for s := start; s.Before(end); s = s.Add(time.Hour) {
+			readings = append(readings, Reading{Start: s, End: s.Add(time.Hour), Amount: amount})
+		}
+		if err := power.StoreMeterUsage(meter, readings); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the main meter has the 17th and 18th, the car is also charged on the
+	// 19th
+	store(MainMeter, at(17, 0), at(19, 0), 1)
+	store("heat pump", at(17, 0), at(19, 0), 0.25)
+	store("car", at(18, 18), at(18, 22), 0.5)
+	store("car", at(19, 1), at(19, 5), 2)
+
+	days, err := power.MeterDays(at(10, 0), at(20, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []MeterDay{
+		{Day: at(17, 0), Amounts: map[string]float64{"heat pump": 6, RemainderMeter: 18}},
+		{Day: at(18, 0), Amounts: map[string]float64{"heat pump": 6, "car": 2, RemainderMeter: 16}},
+	}
+	if len(days) != len(want) {
+		t.Fatalf("got %d days %v, want %d", len(days), days, len(want))
+	}
+	for i := range want {
+		if !days[i].Day.Equal(want[i].Day) {
+			t.Errorf("got day %s, want %s", days[i].Day, want[i].Day)
+		}
+		for _, meter := range power.Meters() {
+			if !near(days[i].Amounts[meter], want[i].Amounts[meter]) {
+				t.Errorf("%s: %s used %.2f, want %.2f", want[i].Day.Format("2006-01-02"), meter, days[i].Amounts[meter], want[i].Amounts[meter])
+			}
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Summary is the electricity used over a calendar period and what it cost
+type Summary struct {
+	From time.Time
+	// To is the end of the last reading, which can be before the end of
+	// the period when it is still going
+	To time.Time
+	// Amount is in kWh and Cost in DKK
+	Amount float64
+	Cost   float64
+	// Price is the average paid in øre/kWh
+	Price float64
+	// Shifting is how well use was moved to the cheap hours of each day
+	Shifting Shifting
+}
+
+// Comparison is a period's summary next to the one it is compared with
+type Comparison struct {
+	Name     string
+	Current  Summary
+	Previous Summary
+}
+
+// Summary periods, each is compared with the same span of the one before
+const (
+	// MonthPeriod is this month so far, against last month up to the same day
+	MonthPeriod = "month"
+	// LastMonthPeriod is all of last month, against the month before
+	LastMonthPeriod = "last-month"
+	// YearPeriod is this year so far, against last year up to the same day
+	YearPeriod = "year"
+	// DayPeriod is the latest day with readings, against the same day a year
+	// earlier
+	DayPeriod = "day"
+)
+
+// Periods are the summary periods in the order they are loaded
+var Periods = []string{MonthPeriod, LastMonthPeriod, YearPeriod, DayPeriod}
+
+// Summarize adds up the readings from start until end, costing each one at
+// the prices paid while it was taken
+func (power *Power) Summarize(start, end time.Time) (Summary, error) {
+	summary := Summary{From: start, To: start}
+	readings, err := power.UsageBetween(start, end)
+	if err != nil {
+		return summary, err
+	}
+	prices, err := power.PricesBetween(start, end)
+	if err != nil {
+		return summary, err
+	}
+	prices = power.consumerPrices(prices)
+
+	for _, r := range readings {
+		summary.Amount += r.Amount
+		summary.To = r.End
+	}
+	// readings without a price count towards the usage but not the cost
+	summary.Shifting = totalShifting(analyseShifting(readings, prices, power.Location))
+	summary.Cost = summary.Shifting.Cost
+	if summary.Amount > 0 {
+		summary.Price = summary.Cost / summary.Amount * 100
+	}
+	return summary, nil
+}
+
+// Compare summarises a period as of now along with the period it is
+// compared with
+func (power *Power) Compare(period string, now time.Time) (Comparison, error) {
+	comparison := Comparison{Name: period}
+	now = now.In(power.Location)
+	day := func(t time.Time, months, days int) time.Time {
+		return time.Date(t.Year(), t.Month()+time.Month(months), t.Day()+days, 0, 0, 0, 0, power.Location)
+	}
+
+	var start, end time.Time
+	// back is how many months earlier the period compared with is
+	back := 1
+	switch period {
+	case MonthPeriod:
+		start, end = day(now, 0, 1-now.Day()), now
+	case LastMonthPeriod:
+		end = day(now, 0, 1-now.Day())
+		start = day(end, -1, 0)
+	case YearPeriod:
+		start, end = time.Date(now.Year(), 1, 1, 0, 0, 0, 0, power.Location), now
+		back = 12
+	case DayPeriod:
+		latest, err := power.LatestUsage()
+		if err != nil {
+			return comparison, err
+		}
+		// a reading ending at midnight belongs to the day before
+		end = day(latest.Add(-time.Nanosecond).In(power.Location), 0, 1)
+		start = day(end, 0, -1)
+		back = 12
+	default:
+		return comparison, fmt.Errorf("unknown summary period %q", period)
+	}
+
+	var err error
+	comparison.Current, err = power.Summarize(start, end)
+	if err != nil {
+		return comparison, err
+	}
+	if comparison.Current.Amount == 0 {
+		return comparison, fmt.Errorf("no usage for %s", period)
+	}
+	// compare against as much of the earlier period as there is of this one
+	if period == MonthPeriod || period == YearPeriod {
+		end = comparison.Current.To.In(power.Location)
+	}
+	comparison.Previous, err = power.Summarize(monthsBefore(start, back), monthsBefore(end, back))
+	return comparison, err
+}
+
+// monthsBefore is the same time n months earlier, or on the last day of the
+// month when that one is shorter
+func monthsBefore(t time.Time, n int) time.Time {
+	earlier := time.Date(t.Year(), t.Month()-time.Month(n), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	day := t.Day()
+	if last := earlier.AddDate(0, 1, -1).Day(); day > last {
+		day = last
+	}
+	return earlier.AddDate(0, 0, day-1)
+}
+
+// Change is how much a value went up from previous to current as a
+// percentage, it is an error when there is nothing to compare with
+func Change(current, previous float64) (float64, error) {
+	if previous == 0 {
+		return 0, errors.New("nothing to compare with")
+	}
+	return (current - previous) / previous * 100, nil
+}
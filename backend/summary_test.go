@@ -0,0 +1,87 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMonthsBefore(t *testing.T) {
+	loc := copenhagen(t)
+	date := func(year int, month time.Month, day, hour int) time.Time {
+		return time.Date(year, month, day, hour, 0, 0, 0, loc)
+	}
+	tests := []struct {
+		name string
+		t    time.Time
+		n    int
+		want time.Time
+	}{
+		{"middle of the month", date(2026, 1, 15, 10), 1, date(2025, 12, 15, 10)},
+		{"end of March", date(2026, 3, 31, 10), 1, date(2026, 2, 28, 10)},
+		{"end of March in a leap year", date(2024, 3, 31, 10), 1, date(2024, 2, 29, 10)},
+		{"end of May", date(2026, 5, 31, 0), 1, date(2026, 4, 30, 0)},
+		{"start of the month", date(2026, 3, 1, 0), 1, date(2026, 2, 1, 0)},
+		{"a year", date(2026, 3, 31, 10), 12, date(2025, 3, 31, 10)},
+		{"a year from a leap day", date(2024, 2, 29, 12), 12, date(2023, 2, 28, 12)},
+	}
+	for _, test := range tests {
+		if got := monthsBefore(test.t, test.n); !got.Equal(test.want) {
+			t.Errorf("%s: got %s, want %s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	power := testPower(t, time.UTC)
+	date := func(year int, month time.Month, day, hour int) time.Time {
+		return time.Date(year, month, day, hour, 0, 0, 0, time.UTC)
+	}
+	now := date(2026, 3, 31, 12)
+	if _, err := power.Compare(MonthPeriod, now); err == nil {
+		t.Error("no error without usage")
+	}
+
+	// 1 kWh an hour, with readings until 10 today and around the same time
+	// last year, and February's priced at 1 DKK/kWh
+	storeHourlyUsage(t, power, date(2026, 2, 1, 0), date(2026, 3, 31, 10))
+	storeHourlyUsage(t, power, date(2025, 3, 30, 0), date(2025, 4, 1, 0))
+	storeSteps(t, power, date(2026, 2, 1, 0), date(2026, 3, 1, 0), time.Hour)
+
+	tests := []struct {
+		period   string
+		from     time.Time
+		to       time.Time
+		amount   float64
+		previous Summary
+	}{
+		// last month is compared up to the same day and hour
+		{MonthPeriod, date(2026, 3, 1, 0), date(2026, 3, 31, 10), 30*24 + 10,
+			Summary{From: date(2026, 2, 1, 0), To: date(2026, 2, 28, 10), Amount: 27*24 + 10, Cost: 27*24 + 10}},
+		{LastMonthPeriod, date(2026, 2, 1, 0), date(2026, 3, 1, 0), 28 * 24,
+			Summary{From: date(2026, 1, 1, 0), To: date(2026, 1, 1, 0)}},
+		{YearPeriod, date(2026, 1, 1, 0), date(2026, 3, 31, 10), 58*24 + 10,
+			Summary{From: date(2025, 1, 1, 0), To: date(2025, 3, 31, 10), Amount: 24 + 10}},
+		{DayPeriod, date(2026, 3, 31, 0), date(2026, 3, 31, 10), 10,
+			Summary{From: date(2025, 3, 31, 0), To: date(2025, 4, 1, 0), Amount: 24}},
+	}
+	for _, test := range tests {
+		comparison, err := power.Compare(test.period, now)
+		if err != nil {
+			t.Errorf("%s: %v", test.period, err)
+			continue
+		}
+		current, previous := comparison.Current, comparison.Previous
+		if !current.From.Equal(test.from) || !current.To.Equal(test.to) || !near(current.Amount, test.amount) {
+			t.Errorf("%s: got %.0f kWh from %s until %s, want %.0f from %s until %s", test.period,
+				current.Amount, current.From, current.To, test.amount, test.from, test.to)
+		}
+		want := test.previous
+		if !previous.From.Equal(want.From) || !previous.To.Equal(want.To) || !near(previous.Amount, want.Amount) || !near(previous.Cost, want.Cost) {
+			t.Errorf("%s: compared with %.0f kWh for %.0f DKK from %s until %s, want %.0f for %.0f from %s until %s", test.period,
+				previous.Amount, previous.Cost, previous.From, previous.To, want.Amount, want.Cost, want.From, want.To)
+		}
+	}
+	if _, err := power.Compare("week", now); err == nil {
+		t.Error("no error for an unknown period")
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Tariff is one part of what is paid on top of the spot price, e.g. a grid
+// company's time of use tariff, elafgift, Energinet's fees or the supplier's
+// markup. All amounts are DKK/kWh before VAT
+type Tariff struct {
+	Name string
+	// From and To are the dates, as 2006-01-02, the tariff applies from and
+	// until (not including To). Either can be left out
+	From string
+	To   string
+	// Months limits the tariff to some months of the year, e.g. the winter
+	// months for a seasonal tariff
+	Months []int
+	// Hours is the amount for each hour of the day, for time of use tariffs,
+	// otherwise Price is charged all day
+	Hours []float64
+	Price float64
+
+	from time.Time
+	to   time.Time
+}
+
+// PriceModel turns spot prices into consumer prices
+type PriceModel struct {
+	Tariffs []Tariff
+	// VAT is a percentage added on top of everything else
+	VAT float64
+	// ExportTariffs are taken off the spot price paid for electricity fed
+	// into the grid, which has no VAT
+	ExportTariffs []Tariff
+}
+
+// load checks the tariff and works out its validity in loc
+func (t *Tariff) load(loc *time.Location) error {
+	var err error
+	if t.From != "" {
+		t.from, err = time.ParseInLocation("2006-01-02", t.From, loc)
+		if err != nil {
+			return fmt.Errorf("tariff %s: %w", t.Name, err)
+		}
+	}
+	if t.To != "" {
+		t.to, err = time.ParseInLocation("2006-01-02", t.To, loc)
+		if err != nil {
+			return fmt.Errorf("tariff %s: %w", t.Name, err)
+		}
+	}
+	if !t.from.IsZero() && !t.to.IsZero() && !t.to.After(t.from) {
+		return fmt.Errorf("tariff %s: ends before it starts", t.Name)
+	}
+	for _, month := range t.Months {
+		if month < 1 || month > 12 {
+			return fmt.Errorf("tariff %s: no month %d", t.Name, month)
+		}
+	}
+	if len(t.Hours) != 0 && len(t.Hours) != 24 {
+		return fmt.Errorf("tariff %s: needs 24 hourly amounts, not %d", t.Name, len(t.Hours))
+	}
+	return nil
+}
+
+// At returns the amount charged at local time t, zero when the tariff does
+// not apply then
+func (t *Tariff) At(local time.Time) float64 {
+	if !t.from.IsZero() && local.Before(t.from) {
+		return 0
+	}
+	if !t.to.IsZero() && !local.Before(t.to) {
+		return 0
+	}
+	if len(t.Months) > 0 {
+		inSeason := false
+		for _, month := range t.Months {
+			if time.Month(month) == local.Month() {
+				inSeason = true
+			}
+		}
+		if !inSeason {
+			return 0
+		}
+	}
+	if len(t.Hours) == 24 {
+		return t.Hours[local.Hour()]
+	}
+	return t.Price
+}
+
+// Apply adds the tariffs and VAT to a spot price. Tariffs change on the
+// hour, so prices are taken at the start of each interval
+func (m *PriceModel) Apply(p PriceInterval, loc *time.Location) PriceInterval {
+	if m == nil {
+		return p
+	}
+	local := p.Start.In(loc)
+	for i := range m.Tariffs {
+		p.Price += m.Tariffs[i].At(local)
+	}
+	p.Price *= 1 + m.VAT/100
+	return p
+}
+
+// Export takes the export tariffs off a spot price, giving what is paid for
+// electricity fed into the grid
+func (m *PriceModel) Export(p PriceInterval, loc *time.Location) PriceInterval {
+	if m == nil {
+		return p
+	}
+	local := p.Start.In(loc)
+	for i := range m.ExportTariffs {
+		p.Price -= m.ExportTariffs[i].At(local)
+	}
+	return p
+}
+
+// consumerPrices are the spot prices as paid
+func (power *Power) consumerPrices(prices []PriceInterval) []PriceInterval {
+	for i := range prices {
+		prices[i] = power.Model.Apply(prices[i], power.Location)
+	}
+	return prices
+}
+
+// exportPrices are the spot prices as paid for export
+func (power *Power) exportPrices(prices []PriceInterval) []PriceInterval {
+	for i := range prices {
+		prices[i] = power.Model.Export(prices[i], power.Location)
+	}
+	return prices
+}
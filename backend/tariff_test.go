@@ -0,0 +1,94 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// testTariffs are a winter time of use grid tariff, elafgift for the first
+// half of 2026 and a supplier's markup
+func testTariffs(t *testing.T, loc *time.Location) []Tariff {
+	t.Helper()
+	grid := make([]float64, 24)
+	for hour := range grid {
+		grid[hour] = 0.1
+		if hour >= 17 && hour < 21 {
+			grid[hour] = 0.4
+		}
+	}
+	tariffs := []Tariff{
+		{Name: "grid", Months: []int{10, 11, 12, 1, 2, 3}, Hours: grid},
+		{Name: "elafgift", From: "2026-01-01", To: "2026-07-01", Price: 0.7},
+		{Name: "markup", Price: 0.05},
+	}
+	for i := range tariffs {
+		if err := tariffs[i].load(loc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return tariffs
+}
+
+func TestTariffAt(t *testing.T) {
+	loc := copenhagen(t)
+	tariffs := testTariffs(t, loc)
+	at := func(month time.Month, day, hour int) time.Time {
+		return time.Date(2026, month, day, hour, 0, 0, 0, loc)
+	}
+	tests := []struct {
+		name   string
+		tariff int
+		at     time.Time
+		want   float64
+	}{
+		{"night", 0, at(1, 18, 3), 0.1},
+		{"peak", 0, at(1, 18, 17), 0.4},
+		{"last peak hour", 0, at(1, 18, 20), 0.4},
+		{"after the peak", 0, at(1, 18, 21), 0.1},
+		{"summer", 0, at(6, 18, 18), 0},
+		{"from", 1, at(1, 1, 0), 0.7},
+		{"before from", 1, at(12, 31, 23).AddDate(-1, 0, 0), 0},
+		{"until", 1, at(6, 30, 23), 0.7},
+		{"to", 1, at(7, 1, 0), 0},
+		{"all day", 2, at(8, 3, 12), 0.05},
+	}
+	for _, test := range tests {
+		if got := tariffs[test.tariff].At(test.at); !near(got, test.want) {
+			t.Errorf("%s: %s at %s is %.2f, want %.2f", test.name, tariffs[test.tariff].Name, test.at, got, test.want)
+		}
+	}
+}
+
+func TestConsumerPrices(t *testing.T) {
+	loc := copenhagen(t)
+	power := &Power{Location: loc, Model: &PriceModel{Tariffs: testTariffs(t, loc), VAT: 25}}
+	// the tariffs go by local time, an hour ahead of UTC in winter and two
+	// in summer
+	utc := func(month time.Month, day, hour int) PriceInterval {
+		start := time.Date(2026, month, day, hour, 0, 0, 0, time.UTC)
+		return PriceInterval{Start: start, End: start.Add(time.Hour), Price: 0.5}
+	}
+	prices := power.consumerPrices([]PriceInterval{
+		utc(1, 18, 15),
+		utc(1, 18, 16),
+		utc(6, 18, 16),
+		utc(8, 18, 16),
+	})
+	want := []float64{
+		(0.5 + 0.1 + 0.7 + 0.05) * 1.25,
+		(0.5 + 0.4 + 0.7 + 0.05) * 1.25,
+		(0.5 + 0.7 + 0.05) * 1.25,
+		(0.5 + 0.05) * 1.25,
+	}
+	for i, p := range prices {
+		if !near(p.Price, want[i]) {
+			t.Errorf("%s: got %.4f, want %.4f", p.Start, p.Price, want[i])
+		}
+	}
+
+	// without a model the spot price is used
+	power.Model = nil
+	if p := power.consumerPrices([]PriceInterval{utc(1, 18, 16)}); p[0].Price != 0.5 {
+		t.Errorf("got %.2f without a model", p[0].Price)
+	}
+}
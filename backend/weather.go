@@ -1,19 +1,67 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
 	"log"
 	"math"
 	"net/http"
-	"strconv"
 	"time"
 )
 
+// WeatherProvider fetches a forecast for a location from a weather service
+type WeatherProvider interface {
+	Fetch(latitude, longitude string) (*WeatherReport, error)
+}
+
+// WeatherReport is a forecast normalised from whichever service provided it
+type WeatherReport struct {
+	Current Observation
+	Sunrise time.Time
+	Sunset  time.Time
+	// Hours starts with the current hour
+	Hours []Observation
+	// Days starts with today
+	Days []DaySummary
+}
+
+// Observation is the weather at a point in time
+type Observation struct {
+	Time        time.Time
+	Description string
+	// Temp is in degrees C
+	Temp          float64
+	Sky           Cover
+	Precipitation Precipitation
+	// PrecipitationAmount is mm over the hour
+	PrecipitationAmount float64
+	PrecipitationType   string
+	// WindSpeed and WindGust are in m/s
+	WindSpeed     float64
+	WindGust      float64
+	WindDirection string
+	// Humidity is a percentage
+	Humidity float64
+	// Pressure is in hPa
+	Pressure float64
+	// Visibility is in metres
+	Visibility float64
+}
+
+// DaySummary is the aggregated forecast for a whole day
+type DaySummary struct {
+	Date    time.Time
+	MinTemp float64
+	MaxTemp float64
+	// Precipitation is the total for the day in mm
+	Precipitation float64
+	UV            float64
+}
+
 type Weather struct {
 	Latitude  string
 	Longitude string
-	weather   data
+	Provider  WeatherProvider
+	weather   *WeatherReport
 }
 
 type Forecast struct {
@@ -54,209 +102,138 @@ const (
 	HeavySnow
 )
 
-// Begin DMI Data Struct
-type data struct {
-	Id         string
-	City       string
-	Country    string
-	Longitude  float64
-	Latitude   float64
-	Timezone   string
-	Lastupdate string
-	Sunrise    string
-	Sunset     string
-	Timeserie  []timeserie
-	AggData    []aggdata
-}
-
-type timeserie struct {
-	Time        string
-	Temp        float64
-	Symbol      int
-	Precip1     float64
-	PrecipType  string
-	WindDir     string
-	WindDegree  float64
-	WindSpeed   float64
-	WindGust    float64
-	Humidity    float64
-	Pressure    float64
-	Visibility  float64
-	Precip3     float64
-	Precip6     float64
-	Temp10      float64
-	Temp50      float64
-	Temp90      float64
-	Prec10      float64
-	Prec50      float64
-	Prec75      float64
-	Prec90      float64
-	Windspeed10 float64
-	Windspeed50 float64
-	Windspeed90 float64
-}
-
-type aggdata struct {
-	Time        string
-	MinTemp     float64
-	MeanTemp    float64
-	MaxTemp     float64
-	PrecipSum   float64
-	UvRadiation float64
+// NewWeatherProvider returns the provider with the given name, either dmi
+// or open-meteo
+func NewWeatherProvider(name string) (WeatherProvider, error) {
+	switch name {
+	case "dmi":
+		return &DMI{BaseURL: dmiURL, Client: http.DefaultClient}, nil
+	case "open-meteo":
+		return &OpenMeteo{BaseURL: openMeteoURL, Client: http.DefaultClient}, nil
+	}
+	return nil, fmt.Errorf("unknown weather provider %q", name)
 }
 
-// End DMI Data Struct
-
-func NewWeather(latitude, longitude string) *Weather {
+func NewWeather(latitude, longitude string, provider WeatherProvider) *Weather {
 	w := new(Weather)
 	w.Longitude = longitude
 	w.Latitude = latitude
+	w.Provider = provider
 	err := w.LoadWeather()
 	if err != nil {
 		log.Println(err)
-        return nil
+		return nil
 	}
 	return w
 }
 
 func (w *Weather) LoadWeather() error {
-	resp, err := http.Get(w.url())
+	report, err := w.Provider.Fetch(w.Latitude, w.Longitude)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
-	return json.NewDecoder(resp.Body).Decode(&w.weather)
-}
-
-func (w *Weather) url() string {
-	return "https://www.dmi.dk/NinJo2DmiDk/ninjo2dmidk?cmd=llj&lon=" + w.Longitude +
-		"&lat=" + w.Latitude
+	if len(report.Hours) == 0 || len(report.Days) == 0 {
+		return fmt.Errorf("weather report for %s, %s is empty", w.Latitude, w.Longitude)
+	}
+	w.weather = report
+	return nil
 }
 
 func (w *Weather) Temp() string {
-	return fmt.Sprintf("%.1f", w.weather.Timeserie[0].Temp)
+	return fmt.Sprintf("%.1f", w.weather.Current.Temp)
 }
 
 func (w *Weather) MaxTemp() string {
-	return fmt.Sprintf("%.0f", w.weather.AggData[0].MaxTemp)
+	return fmt.Sprintf("%.0f", w.weather.Days[0].MaxTemp)
 }
 
 func (w *Weather) MinTemp() string {
-	return fmt.Sprintf("%.0f", w.weather.AggData[0].MinTemp)
+	return fmt.Sprintf("%.0f", w.weather.Days[0].MinTemp)
 }
 
 func (w *Weather) Pressure() string {
-	return fmt.Sprintf("%.0f", w.weather.Timeserie[0].Pressure)
+	return fmt.Sprintf("%.0f", w.weather.Current.Pressure)
 }
 
 func (w *Weather) WindSpeed() string {
-	return fmt.Sprintf("%.1f", w.weather.Timeserie[0].WindSpeed)
+	return fmt.Sprintf("%.1f", w.weather.Current.WindSpeed)
 }
 
 func (w *Weather) WindDirection() string {
-	return w.weather.Timeserie[0].WindDir
+	return w.weather.Current.WindDirection
 }
 
 func (w *Weather) WindGust() string {
-	return fmt.Sprintf("%.1f", w.weather.Timeserie[0].WindGust)
+	return fmt.Sprintf("%.1f", w.weather.Current.WindGust)
 }
 
 func (w *Weather) PrecipitationAmount() string {
-	return fmt.Sprintf("%.0f", w.weather.Timeserie[0].Precip1)
+	return fmt.Sprintf("%.0f", w.weather.Current.PrecipitationAmount)
 }
 
 func (w *Weather) DayPrecipitationAmount() string {
-	return fmt.Sprintf("%0.1f", w.weather.AggData[0].PrecipSum)
+	return fmt.Sprintf("%0.1f", w.weather.Days[0].Precipitation)
 }
 
 func (w *Weather) PrecipitationType() string {
-	if w.weather.Timeserie[0].Precip1 < 0.5 {
+	if w.weather.Current.PrecipitationAmount < 0.5 {
 		return ""
 	}
-	return w.weather.Timeserie[0].PrecipType
+	return w.weather.Current.PrecipitationType
 }
 
 func (w *Weather) UV() string {
-	return fmt.Sprintf("%0.1f", w.weather.AggData[0].UvRadiation)
+	return fmt.Sprintf("%0.1f", w.weather.Days[0].UV)
 }
 
 func (w *Weather) Humidity() string {
-	return fmt.Sprintf("%0.0f", w.weather.Timeserie[0].Humidity)
+	return fmt.Sprintf("%0.0f", w.weather.Current.Humidity)
 }
 
 func (w *Weather) Visibility() string {
-	if w.weather.Timeserie[0].Visibility >= 1500 {
-		return fmt.Sprintf("%0.1f", w.weather.Timeserie[0].Visibility/1000)
+	if w.weather.Current.Visibility >= 1500 {
+		return fmt.Sprintf("%0.1f", w.weather.Current.Visibility/1000)
 	}
-	return fmt.Sprintf("%0.0f", w.weather.Timeserie[0].Visibility)
+	return fmt.Sprintf("%0.0f", w.weather.Current.Visibility)
 
 }
 
 func (w *Weather) VisibiltyDistance() string {
-	if w.weather.Timeserie[0].Visibility >= 1500 {
+	if w.weather.Current.Visibility >= 1500 {
 		return "km"
 	}
 	return "m"
 }
 
 func (w *Weather) Conditions() string {
-	switch w.weather.Timeserie[0].Symbol {
-	case 1:
-		return "Sunny"
-	case 2, 102:
-		return "Broken Clouds"
-	case 3, 103:
-		return "Cloudy"
-	case 45, 145:
-		return "Fog"
-	case 60, 80, 160, 180:
-		return "Light Rain"
-	case 63, 81, 163, 181:
-		return "Heavy Rain"
-	case 68, 83, 168, 183:
-		return "Light Sleet"
-	case 69, 84, 169, 184:
-		return "Heavy Sleet"
-	case 70, 85, 170, 185:
-		return "Light Snow"
-	case 73, 86, 173, 186:
-		return "Heavy Snow"
-	case 101:
-		return "Clear"
-	default:
-		return "Undefined " + strconv.Itoa(w.weather.Timeserie[0].Symbol)
-	}
+	return w.weather.Current.Description
 }
 
 func (w *Weather) Sunrise() string {
-	return "0" + w.weather.Sunrise[:1] + ":" + w.weather.Sunrise[1:]
+	return w.weather.Sunrise.Format("15:04")
 }
 
 func (w *Weather) Sunset() string {
-	return w.weather.Sunset[:2] + ":" + w.weather.Sunset[2:]
+	return w.weather.Sunset.Format("15:04")
 }
 
 // Forecast gives five day-summary forecasts
 func (w *Weather) Forecast() []*Forecast {
 	var forecasts []*Forecast
 	max := 6
-	if len(w.weather.AggData) < max {
-		max = len(w.weather.AggData)
+	if len(w.weather.Days) < max {
+		max = len(w.weather.Days)
 	}
 	for i := 1; i < max; i++ {
 		f := new(Forecast)
-		date := w.weather.AggData[i].Time
-		t, err := time.Parse("20060102", date)
-		if err != nil {
-			fmt.Println(err)
-		}
-		if t.Weekday() == time.Saturday || t.Weekday() == time.Sunday {
+		day := w.weather.Days[i]
+		if day.Date.Weekday() == time.Saturday || day.Date.Weekday() == time.Sunday {
 			f.Weekend = true
 		}
-		f.Date = date[6:] + "/" + date[4:6]
-		f.TempMin = fmt.Sprintf("%.0f", w.weather.AggData[i].MinTemp)
-		f.TempMax = fmt.Sprintf("%.0f", w.weather.AggData[i].MaxTemp)
-		f.PrecipitationAmount = fmt.Sprintf("%.1f", w.weather.AggData[i].PrecipSum)
+		f.Date = day.Date.Format("02/01")
+		f.TempMin = fmt.Sprintf("%.0f", day.MinTemp)
+		f.TempMax = fmt.Sprintf("%.0f", day.MaxTemp)
+		f.PrecipitationAmount = fmt.Sprintf("%.1f", day.Precipitation)
 		forecasts = append(forecasts, f)
 	}
 	return forecasts
@@ -265,43 +242,26 @@ func (w *Weather) Forecast() []*Forecast {
 // HourForecast returns 48 hours worth of spot forecast including current conditions
 func (w *Weather) HourForecast() []*Hour {
 	var hours []*Hour
-	for i := 0; i < 48; i++ {
+	for i := 0; i < 48 && i < len(w.weather.Hours); i++ {
+		o := w.weather.Hours[i]
 		h := new(Hour)
 		hours = append(hours, h)
-		hour, err := strconv.Atoi(w.weather.Timeserie[i].Time[8:10])
-		h.Hour = hour
-		if err != nil {
-			log.Fatal(err)
-		}
-		h.Temperature = int(math.Round(w.weather.Timeserie[i].Temp * 10))
-		switch w.weather.Timeserie[i].Symbol {
-		case 1, 101:
-			h.Sky = Clear
-		case 2, 80, 81, 83, 84, 85, 86, 102, 180, 181, 183, 184, 185, 186:
-			h.Sky = Broken
-		case 3, 60, 63, 68, 69, 70, 73, 103, 160, 163, 168, 169, 170, 173:
-			h.Sky = Cloudy
-		case 45, 145:
-			h.Sky = Fog
-		default:
-			fmt.Println("Unknown symbol: ", w.weather.Timeserie[i].Symbol, "at hour", i)
-		}
-		switch w.weather.Timeserie[i].Symbol {
-		case 60, 80, 160, 180:
-			h.Precipitation = LightRain
-		case 63, 81, 163, 181:
-			h.Precipitation = HeavyRain
-		case 68, 83, 168, 183:
-			h.Precipitation = LightSleet
-		case 69, 84, 169, 184:
-			h.Precipitation = HeavySleet
-		case 70, 85, 170, 185:
-			h.Precipitation = LightSnow
-		case 73, 86, 173, 186:
-			h.Precipitation = HeavySnow
-		}
-
-		h.PrecipitationAmount = int(math.Round(w.weather.Timeserie[i].Precip1))
+		h.Hour = o.Time.Hour()
+		h.Temperature = int(math.Round(o.Temp * 10))
+		h.Sky = o.Sky
+		h.Precipitation = o.Precipitation
+		h.PrecipitationAmount = int(math.Round(o.PrecipitationAmount))
 	}
 	return hours
 }
+
+// compassDirection turns a wind bearing in degrees into one of the eight
+// compass points
+func compassDirection(degrees float64) string {
+	points := []string{"N", "NE", "E", "SE", "S", "SW", "W", "NW"}
+	i := int(math.Round(math.Mod(degrees, 360)/45)) % 8
+	if i < 0 {
+		i += 8
+	}
+	return points[i]
+}
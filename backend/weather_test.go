@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fixtureServer serves a file from testdata for every request, keeping the
+// last request's URL
+func fixtureServer(t *testing.T, name string) (*httptest.Server, *string) {
+	t.Helper()
+	body, err := ioutil.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var requested string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = r.URL.String()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requested
+}
+
+// sameObservation compares observations with their times in any zone
+func sameObservation(a, b Observation) bool {
+	if !a.Time.Equal(b.Time) {
+		return false
+	}
+	a.Time, b.Time = time.Time{}, time.Time{}
+	return a == b
+}
+
+func copenhagen(t *testing.T) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation("Europe/Copenhagen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc
+}
+
+func TestDMIFetch(t *testing.T) {
+	server, requested := fixtureServer(t, "dmi.json")
+	dmi := &DMI{BaseURL: server.URL, Client: server.Client()}
+	report, err := dmi.Fetch("55.7034", "12.5823")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(*requested, "lat=55.7034") || !strings.Contains(*requested, "lon=12.5823") {
+		t.Errorf("requested %s", *requested)
+	}
+	loc := copenhagen(t)
+
+	if len(report.Hours) != 3 {
+		t.Fatalf("got %d hours, want 3", len(report.Hours))
+	}
+	want := Observation{
+		Time:                time.Date(2026, 1, 18, 9, 0, 0, 0, loc),
+		Description:         "Heavy Rain",
+		Temp:                -0.8,
+		Sky:                 Cloudy,
+		Precipitation:       HeavyRain,
+		PrecipitationAmount: 1.4,
+		PrecipitationType:   "rain",
+		WindSpeed:           5.3,
+		WindGust:            11.2,
+		WindDirection:       "SV",
+		Humidity:            95,
+		Pressure:            1010.4,
+		Visibility:          4000,
+	}
+	if got := report.Hours[1]; !sameObservation(got, want) {
+		t.Errorf("hour 1 is %+v, want %+v", got, want)
+	}
+	if report.Current != report.Hours[0] {
+		t.Errorf("current is %+v, want the first hour", report.Current)
+	}
+	if report.Hours[0].Sky != Cloudy || report.Hours[0].Description != "Cloudy" {
+		t.Errorf("hour 0 is %+v", report.Hours[0])
+	}
+	if h := report.Hours[2]; h.Sky != Broken || h.Precipitation != LightSnow {
+		t.Errorf("hour 2 is %+v", h)
+	}
+
+	wantDays := []DaySummary{
+		{Date: time.Date(2026, 1, 18, 0, 0, 0, 0, loc), MinTemp: -2.1, MaxTemp: 2.4, Precipitation: 3.1, UV: 0.4},
+		{Date: time.Date(2026, 1, 19, 0, 0, 0, 0, loc), MinTemp: -4.5, MaxTemp: 1.2, Precipitation: 0, UV: 0.6},
+	}
+	if len(report.Days) != len(wantDays) {
+		t.Fatalf("got %d days, want %d", len(report.Days), len(wantDays))
+	}
+	for i, d := range wantDays {
+		if !report.Days[i].Date.Equal(d.Date) || report.Days[i].MinTemp != d.MinTemp || report.Days[i].MaxTemp != d.MaxTemp ||
+			report.Days[i].Precipitation != d.Precipitation || report.Days[i].UV != d.UV {
+			t.Errorf("day %d is %+v, want %+v", i, report.Days[i], d)
+		}
+	}
+	// DMI only gives the clock, the date is today's
+	if got := report.Sunrise.Format("15:04"); got != "08:33" {
+		t.Errorf("sunrise at %s", got)
+	}
+	if got := report.Sunset.Format("15:04"); got != "16:01" {
+		t.Errorf("sunset at %s", got)
+	}
+}
+
+func TestDMIFetchError(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+	dmi := &DMI{BaseURL: server.URL, Client: server.Client()}
+	if _, err := dmi.Fetch("1", "2"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("got %v, want a 404 error", err)
+	}
+}
+
+func TestOpenMeteoFetch(t *testing.T) {
+	server, requested := fixtureServer(t, "openmeteo.json")
+	om := &OpenMeteo{BaseURL: server.URL, Client: server.Client()}
+	report, err := om.Fetch("55.7", "12.58")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, param := range []string{"latitude=55.7", "longitude=12.58", "wind_speed_unit=ms", "timezone=auto"} {
+		if !strings.Contains(*requested, param) {
+			t.Errorf("requested %s without %s", *requested, param)
+		}
+	}
+	loc := copenhagen(t)
+
+	want := Observation{
+		Time:                time.Date(2026, 1, 18, 8, 15, 0, 0, loc),
+		Description:         "Light Snow",
+		Temp:                -1.2,
+		Sky:                 Cloudy,
+		Precipitation:       LightSnow,
+		PrecipitationAmount: 0.1,
+		WindSpeed:           4.4,
+		WindGust:            9.8,
+		WindDirection:       "S",
+		Humidity:            91,
+		Pressure:            1011.6,
+		Visibility:          7200,
+	}
+	if !sameObservation(report.Current, want) {
+		t.Errorf("current is %+v, want %+v", report.Current, want)
+	}
+	if len(report.Days) != 2 {
+		t.Fatalf("got %d days, want 2", len(report.Days))
+	}
+	day := report.Days[1]
+	if !day.Date.Equal(time.Date(2026, 1, 19, 0, 0, 0, 0, loc)) || day.MinTemp != -2.2 || day.MaxTemp != 2.5 || day.UV != 0.7 {
+		t.Errorf("day 1 is %+v", day)
+	}
+	if !report.Sunrise.Equal(time.Date(2026, 1, 18, 8, 33, 0, 0, loc)) {
+		t.Errorf("sunrise at %s", report.Sunrise)
+	}
+	if !report.Sunset.Equal(time.Date(2026, 1, 18, 16, 1, 0, 0, loc)) {
+		t.Errorf("sunset at %s", report.Sunset)
+	}
+}
+
+func TestOpenMeteoHoursFromNow(t *testing.T) {
+	body, err := ioutil.ReadFile("testdata/openmeteo.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var weather openMeteoData
+	if err = json.Unmarshal(body, &weather); err != nil {
+		t.Fatal(err)
+	}
+	loc := copenhagen(t)
+	report, err := weather.report(time.Date(2026, 1, 18, 8, 40, 0, 0, loc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the hours before the current one are dropped
+	if len(report.Hours) != 2 {
+		t.Fatalf("got %d hours, want 2", len(report.Hours))
+	}
+	first := report.Hours[0]
+	if !first.Time.Equal(time.Date(2026, 1, 18, 8, 0, 0, 0, loc)) || first.Temp != -1.2 || first.Precipitation != LightSnow {
+		t.Errorf("first hour is %+v", first)
+	}
+	if h := report.Hours[1]; h.Description != "Heavy Rain" || h.PrecipitationAmount != 0.6 {
+		t.Errorf("second hour is %+v", h)
+	}
+}
+
+func TestOpenMeteoMismatchedLengths(t *testing.T) {
+	server, _ := fixtureServer(t, "openmeteo-mismatched.json")
+	om := &OpenMeteo{BaseURL: server.URL, Client: server.Client()}
+	_, err := om.Fetch("55.7", "12.58")
+	if err == nil || !strings.Contains(err.Error(), "hourly series have different lengths") {
+		t.Errorf("got %v, want a length mismatch", err)
+	}
+}